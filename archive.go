@@ -0,0 +1,198 @@
+package cfft
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+)
+
+// DefaultArchiveDir is the default directory to archive LIVE function code, relative to the config file.
+const DefaultArchiveDir = ".cfft/archive"
+
+// ArchiveConfig is the configuration of the archive of the published function code.
+type ArchiveConfig struct {
+	Dir string `json:"dir" yaml:"dir"`
+}
+
+// Reasons of archiving the LIVE function.
+const (
+	ArchiveReasonPublish  = "publish"
+	ArchiveReasonRollback = "rollback"
+)
+
+// ArchiveEntry is an archived LIVE function code and config.
+type ArchiveEntry struct {
+	ID         string                `json:"id"`
+	Name       string                `json:"name"`
+	ETag       string                `json:"etag"`
+	ArchivedAt time.Time             `json:"archivedAt"`
+	Reason     string                `json:"reason,omitempty"` // the command which archived the entry. empty means publish
+	Config     *types.FunctionConfig `json:"config"`
+	Code       string                `json:"code"`
+}
+
+// IsRollback reports whether the entry was archived by rollback.
+// It is the code which was LIVE before the rollback, so it is not a target of rollback by default.
+func (e *ArchiveEntry) IsRollback() bool {
+	return e.Reason == ArchiveReasonRollback
+}
+
+// ArchiveStorage stores the archive entries.
+type ArchiveStorage interface {
+	Save(ctx context.Context, entry *ArchiveEntry) error
+	// List returns the entries of the function in order of the archived time.
+	List(ctx context.Context, name string) ([]*ArchiveEntry, error)
+	Load(ctx context.Context, name, id string) (*ArchiveEntry, error)
+}
+
+// localArchive stores the entries as JSON files in <dir>/<function name>/<id>.json.
+type localArchive struct {
+	dir string
+}
+
+func newLocalArchive(dir string) *localArchive {
+	return &localArchive{dir: dir}
+}
+
+func (a *localArchive) path(name, id string) string {
+	return filepath.Join(a.dir, name, id+".json")
+}
+
+func (a *localArchive) Save(ctx context.Context, entry *ArchiveEntry) error {
+	p := a.path(entry.Name, entry.ID)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return fmt.Errorf("failed to create archive directory, %w", err)
+	}
+	b, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal archive entry, %w", err)
+	}
+	if err := os.WriteFile(p, append(b, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write archive %s, %w", p, err)
+	}
+	return nil
+}
+
+func (a *localArchive) List(ctx context.Context, name string) ([]*ArchiveEntry, error) {
+	files, err := os.ReadDir(filepath.Join(a.dir, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read archive directory, %w", err)
+	}
+	var entries []*ArchiveEntry
+	for _, file := range files {
+		id, ok := strings.CutSuffix(file.Name(), ".json")
+		if !ok || file.IsDir() {
+			continue
+		}
+		entry, err := a.Load(ctx, name, id)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].ArchivedAt.Before(entries[j].ArchivedAt)
+	})
+	return entries, nil
+}
+
+// validateArchiveID validates the id of the archive entry, which must not point outside the archive of the function.
+func validateArchiveID(id string) error {
+	if id == "" || id == "." || strings.Contains(id, "..") || strings.ContainsAny(id, `/\`) {
+		return fmt.Errorf("invalid archive id %q", id)
+	}
+	return nil
+}
+
+func (a *localArchive) Load(ctx context.Context, name, id string) (*ArchiveEntry, error) {
+	if err := validateArchiveID(id); err != nil {
+		return nil, err
+	}
+	p := a.path(name, id)
+	b, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("archive %s of function %s not found", id, name)
+		}
+		return nil, fmt.Errorf("failed to read archive %s, %w", p, err)
+	}
+	var entry ArchiveEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse archive %s, %w", p, err)
+	}
+	return &entry, nil
+}
+
+// archiveStorage returns the storage of the archive.
+func (app *CFFT) archiveStorage() ArchiveStorage {
+	dir := DefaultArchiveDir
+	if app.config.Archive != nil && app.config.Archive.Dir != "" {
+		dir = app.config.Archive.Dir
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(app.config.dir, dir)
+	}
+	return newLocalArchive(dir)
+}
+
+// liveArchiveEntry returns the archive entry of the code and config of the current LIVE function with the reason.
+// It returns nil entry if the function is not published yet. The entry is saved by saveArchive after the LIVE function is replaced.
+func (app *CFFT) liveArchiveEntry(ctx context.Context, reason string) (*ArchiveEntry, error) {
+	name := app.config.Name
+	res, err := app.cloudfront.GetFunction(ctx, &cloudfront.GetFunctionInput{
+		Name:  aws.String(name),
+		Stage: types.FunctionStageLive,
+	})
+	if err != nil {
+		var notFound *types.NoSuchFunctionExists
+		if errors.As(err, &notFound) {
+			slog.Info(f("function %s is not published yet. nothing to archive", name))
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get LIVE function, %w", err)
+	}
+	desc, err := app.cloudfront.DescribeFunction(ctx, &cloudfront.DescribeFunctionInput{
+		Name:  aws.String(name),
+		Stage: types.FunctionStageLive,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe LIVE function, %w", err)
+	}
+	now := time.Now().UTC()
+	etag := aws.ToString(res.ETag)
+	return &ArchiveEntry{
+		ID:         now.Format("20060102-150405") + "-" + etag,
+		Name:       name,
+		ETag:       etag,
+		ArchivedAt: now,
+		Reason:     reason,
+		Config:     desc.FunctionSummary.FunctionConfig,
+		Code:       string(res.FunctionCode),
+	}, nil
+}
+
+// saveArchive saves the entry returned by liveArchiveEntry. Nothing is saved for nil entry.
+func (app *CFFT) saveArchive(ctx context.Context, entry *ArchiveEntry) error {
+	if entry == nil {
+		return nil
+	}
+	if err := app.archiveStorage().Save(ctx, entry); err != nil {
+		return fmt.Errorf("failed to archive the previous LIVE function, %w", err)
+	}
+	slog.Info(f("previous LIVE function %s is archived as %s", entry.Name, entry.ID))
+	return nil
+}
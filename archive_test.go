@@ -0,0 +1,275 @@
+package cfft_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/fujiwara/cfft"
+)
+
+func TestLocalArchive(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	dir := t.TempDir()
+	archive := cfft.NewLocalArchive(dir)
+	now := time.Now().UTC()
+	for i, id := range []string{"20240102-000000-E2", "20240101-000000-E1"} {
+		entry := &cfft.ArchiveEntry{
+			ID:         id,
+			Name:       "simple-v2",
+			ETag:       id[len(id)-2:],
+			ArchivedAt: now.Add(-time.Duration(i) * time.Hour),
+			Code:       "function handler(event) { return event.request; }",
+		}
+		if err := archive.Save(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := archive.List(ctx, "simple-v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ID != "20240101-000000-E1" || entries[1].ID != "20240102-000000-E2" {
+		t.Errorf("entries must be sorted by archived time: %v", entries)
+	}
+	entry, err := archive.Load(ctx, "simple-v2", "20240101-000000-E1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.ETag != "E1" || !strings.Contains(entry.Code, "handler") {
+		t.Errorf("unexpected entry: %#v", entry)
+	}
+	if _, err := archive.Load(ctx, "simple-v2", "unknown"); err == nil {
+		t.Error("expected error for unknown archive")
+	}
+	if entries, err := archive.List(ctx, "other"); err != nil || len(entries) != 0 {
+		t.Errorf("unexpected entries of other function: %v, %v", entries, err)
+	}
+
+	// rollback --list
+	conf, err := cfft.LoadConfig(ctx, "testdata/funcv2/cfft.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.Archive = &cfft.ArchiveConfig{Dir: dir}
+	app, err := cfft.New(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	app.SetStdout(&buf)
+	if err := app.RollbackFunction(ctx, &cfft.RollbackCmd{List: true}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "20240101-000000-E1\t") {
+		t.Errorf("unexpected list: %s", buf.String())
+	}
+}
+
+// fakeCloudFront emulates the CloudFront API calls used by rollback.
+type fakeCloudFront struct {
+	liveCode   string
+	liveETag   string
+	devETag    string
+	config     *types.FunctionConfig
+	updated    *cloudfront.UpdateFunctionInput
+	published  *cloudfront.PublishFunctionInput
+	publishErr error
+}
+
+// client returns a CloudFront client which returns the results of the fake without calling the API.
+func (f *fakeCloudFront) client() *cloudfront.Client {
+	return cloudfront.New(cloudfront.Options{
+		Region: "us-east-1",
+		APIOptions: []func(*middleware.Stack) error{
+			func(stack *middleware.Stack) error {
+				return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("fake", f.handle), middleware.Before)
+			},
+		},
+	})
+}
+
+func (f *fakeCloudFront) handle(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	var out any
+	switch p := in.Parameters.(type) {
+	case *cloudfront.GetFunctionInput:
+		out = &cloudfront.GetFunctionOutput{FunctionCode: []byte(f.liveCode), ETag: aws.String(f.liveETag)}
+	case *cloudfront.DescribeFunctionInput:
+		etag := f.devETag
+		if p.Stage == types.FunctionStageLive {
+			etag = f.liveETag
+		}
+		out = &cloudfront.DescribeFunctionOutput{
+			ETag:            aws.String(etag),
+			FunctionSummary: &types.FunctionSummary{Name: p.Name, FunctionConfig: f.config},
+		}
+	case *cloudfront.UpdateFunctionInput:
+		f.updated = p
+		f.devETag = "E-UPDATED"
+		out = &cloudfront.UpdateFunctionOutput{ETag: aws.String(f.devETag)}
+	case *cloudfront.PublishFunctionInput:
+		if f.publishErr != nil {
+			return middleware.InitializeOutput{}, middleware.Metadata{}, f.publishErr
+		}
+		f.published = p
+		f.liveCode = string(f.updated.FunctionCode)
+		f.config = f.updated.FunctionConfig
+		f.liveETag = "E-PUBLISHED"
+		out = &cloudfront.PublishFunctionOutput{}
+	default:
+		return middleware.InitializeOutput{}, middleware.Metadata{}, fmt.Errorf("unexpected call %T", p)
+	}
+	return middleware.InitializeOutput{Result: out}, middleware.Metadata{}, nil
+}
+
+func TestRollback(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	dir := t.TempDir()
+	archive := cfft.NewLocalArchive(dir)
+	now := time.Now().UTC()
+	for i, name := range []string{"A", "B"} {
+		entry := &cfft.ArchiveEntry{
+			ID:         "2024010" + fmt.Sprint(i+1) + "-000000-E" + name,
+			Name:       "simple-v2",
+			ETag:       "E" + name,
+			ArchivedAt: now.Add(time.Duration(i-2) * time.Hour),
+			Reason:     cfft.ArchiveReasonPublish,
+			Config:     &types.FunctionConfig{Comment: aws.String(name), Runtime: types.FunctionRuntimeCloudfrontJs20},
+			Code:       "function handler(event) { /* " + name + " */ return event.request; }",
+		}
+		if err := archive.Save(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conf, err := cfft.LoadConfig(ctx, "testdata/funcv2/cfft.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.Archive = &cfft.ArchiveConfig{Dir: dir}
+	app, err := cfft.New(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeCloudFront{
+		liveCode: "function handler(event) { /* broken */ }",
+		liveETag: "E-LIVE",
+		devETag:  "E-DEV",
+		config:   &types.FunctionConfig{Comment: aws.String("broken"), Runtime: types.FunctionRuntimeCloudfrontJs20},
+	}
+	app.SetCloudFront(fake.client())
+
+	// roll back to the latest archive saved by publish
+	if err := app.RollbackFunction(ctx, &cfft.RollbackCmd{}); err != nil {
+		t.Fatal(err)
+	}
+	if u := fake.updated; aws.ToString(u.IfMatch) != "E-DEV" || !strings.Contains(string(u.FunctionCode), "/* B */") || aws.ToString(u.FunctionConfig.Comment) != "B" {
+		t.Errorf("DEVELOPMENT function must be updated by the archive B: %s %s", u.FunctionCode, aws.ToString(u.FunctionConfig.Comment))
+	}
+	if p := fake.published; p == nil || aws.ToString(p.IfMatch) != "E-UPDATED" || aws.ToString(p.Name) != "simple-v2" {
+		t.Errorf("the updated function must be published: %#v", p)
+	}
+
+	// the broken LIVE function is archived by rollback
+	entries, err := archive.List(ctx, "simple-v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+	if latest := entries[2]; !latest.IsRollback() || !strings.Contains(latest.Code, "broken") || latest.ETag != "E-LIVE" {
+		t.Errorf("unexpected archive by rollback: %#v", latest)
+	}
+
+	// the latest archive is saved by rollback, so --to is required
+	if err := app.RollbackFunction(ctx, &cfft.RollbackCmd{}); err == nil || !strings.Contains(err.Error(), "--to") {
+		t.Errorf("expected error requiring --to, got %v", err)
+	}
+	if err := app.RollbackFunction(ctx, &cfft.RollbackCmd{To: entries[0].ID}); err != nil {
+		t.Fatal(err)
+	}
+	if u := fake.updated; !strings.Contains(string(u.FunctionCode), "/* A */") || aws.ToString(u.FunctionConfig.Comment) != "A" {
+		t.Errorf("DEVELOPMENT function must be updated by the archive A: %s", u.FunctionCode)
+	}
+
+	// --to must not point outside the archive
+	outside := *entries[0]
+	outside.Name = "."
+	outside.ID = "outside"
+	if err := archive.Save(ctx, &outside); err != nil {
+		t.Fatal(err)
+	}
+	fake.updated = nil
+	for _, id := range []string{"../outside", "..", "../simple-v2/" + entries[0].ID} {
+		if err := app.RollbackFunction(ctx, &cfft.RollbackCmd{To: id}); err == nil || !strings.Contains(err.Error(), "invalid archive id") {
+			t.Errorf("expected error for archive id %s, got %v", id, err)
+		}
+	}
+	if fake.updated != nil {
+		t.Errorf("DEVELOPMENT function must not be updated by an invalid archive id: %s", fake.updated.FunctionCode)
+	}
+}
+
+func TestArchiveNotSavedOnPublishFailure(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	dir := t.TempDir()
+	archive := cfft.NewLocalArchive(dir)
+	entry := &cfft.ArchiveEntry{
+		ID:         "20240101-000000-EA",
+		Name:       "simple-v2",
+		ETag:       "EA",
+		ArchivedAt: time.Now().UTC().Add(-time.Hour),
+		Reason:     cfft.ArchiveReasonPublish,
+		Code:       "function handler(event) { /* A */ return event.request; }",
+	}
+	if err := archive.Save(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := cfft.LoadConfig(ctx, "testdata/funcv2/cfft.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.Archive = &cfft.ArchiveConfig{Dir: dir}
+	app, err := cfft.New(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := conf.FunctionCode(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeCloudFront{
+		// the fake returns the same code for DEVELOPMENT and LIVE, so publish finds the code up-to-date
+		liveCode:   string(code),
+		liveETag:   "E-LIVE",
+		devETag:    "E-DEV",
+		config:     &types.FunctionConfig{Runtime: types.FunctionRuntimeCloudfrontJs20},
+		publishErr: errors.New("PreconditionFailed"),
+	}
+	app.SetCloudFront(fake.client())
+
+	if err := app.PublishFunction(ctx, &cfft.PublishCmd{}); err == nil || !strings.Contains(err.Error(), "PreconditionFailed") {
+		t.Errorf("expected publish error, got %v", err)
+	}
+	if err := app.RollbackFunction(ctx, &cfft.RollbackCmd{}); err == nil || !strings.Contains(err.Error(), "PreconditionFailed") {
+		t.Errorf("expected publish error, got %v", err)
+	}
+	// the LIVE function is not replaced, so it must not be archived
+	entries, err := archive.List(ctx, "simple-v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ID != entry.ID {
+		t.Errorf("archive must not be saved when the publish fails: %v", entries)
+	}
+}
@@ -0,0 +1,93 @@
+package cfft
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/itchyny/gojq"
+)
+
+// assertion is a jq expression which must be evaluated to true against the function output.
+type assertion struct {
+	expr string
+	code *gojq.Code
+}
+
+// AssertionError is returned when an assertion of a test case fails.
+type AssertionError struct {
+	Expr   string
+	Reason string
+}
+
+func (e *AssertionError) Error() string {
+	return fmt.Sprintf("assertion %s %s", e.Expr, e.Reason)
+}
+
+func compileAssertions(exprs []string) ([]*assertion, error) {
+	assertions := make([]*assertion, 0, len(exprs))
+	for _, expr := range exprs {
+		q, err := gojq.Parse(expr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse assertion %s, %w", expr, err)
+		}
+		code, err := gojq.Compile(q)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile assertion %s, %w", expr, err)
+		}
+		assertions = append(assertions, &assertion{expr: expr, code: code})
+	}
+	return assertions, nil
+}
+
+// check evaluates the assertion. All the values of the expression must be true.
+func (a *assertion) check(v any) error {
+	iter := a.code.Run(v)
+	n := 0
+	for {
+		r, ok := iter.Next()
+		if !ok {
+			break
+		}
+		n++
+		switch r := r.(type) {
+		case error:
+			return &AssertionError{Expr: a.expr, Reason: f("failed with error: %s", r)}
+		case bool:
+			if !r {
+				return &AssertionError{Expr: a.expr, Reason: "is false"}
+			}
+		default:
+			b, _ := gojq.Marshal(r)
+			return &AssertionError{Expr: a.expr, Reason: f("returned a non-boolean value: %s", string(b))}
+		}
+	}
+	if n == 0 {
+		return &AssertionError{Expr: a.expr, Reason: "returned no value"}
+	}
+	return nil
+}
+
+// checkAssertions evaluates all the assertions against the function output and returns the errors of failed assertions.
+func (c *TestCase) checkAssertions(output []byte, logger *slog.Logger) []error {
+	if len(c.assertions) == 0 {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(output, &v); err != nil {
+		return []error{fmt.Errorf("failed to parse function output, %w", err)}
+	}
+	var errs []error
+	for _, a := range c.assertions {
+		if err := a.check(v); err != nil {
+			logger.Warn(err.Error())
+			errs = append(errs, err)
+		} else {
+			logger.Debug(f("assertion %s passed", a.expr))
+		}
+	}
+	if len(errs) == 0 {
+		logger.Info(f("%d assertions passed", len(c.assertions)))
+	}
+	return errs
+}
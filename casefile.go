@@ -0,0 +1,157 @@
+package cfft
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// CaseFileExt is the extension of the test case file which contains both of the event and the expect.
+	CaseFileExt = ".cfftcase"
+
+	// CaseFileSeparator separates the sections of the test case file.
+	CaseFileSeparator = "###"
+
+	caseHeaderViewerIP  = "cfft-viewer-ip"
+	caseHeaderEventType = "cfft-event-type"
+
+	defaultCaseViewerIP = "127.0.0.1"
+)
+
+func isCaseFile(p string) bool {
+	return filepath.Ext(p) == CaseFileExt
+}
+
+// parseCaseFile parses the test case file and returns the event and expect objects as JSON.
+// expect is nil when the file has no expect section.
+//
+// The sections are separated by a line of "###".
+// The first section is the request in the HTTP text format, which may have the pseudo headers
+// Cfft-Viewer-Ip and Cfft-Event-Type. For viewer-response, the second section is the response.
+// The last section is the expected request or response in the HTTP text format.
+func parseCaseFile(b []byte) (event []byte, expect []byte, err error) {
+	sections := splitCaseFile(string(b))
+	if len(sections) == 0 || sections[0] == "" {
+		return nil, nil, fmt.Errorf("request is not found in the test case file")
+	}
+
+	reqText, eventType, viewerIP := extractCaseHeaders(sections[0])
+	req, err := ParseRequest(reqText)
+	if err != nil {
+		return nil, nil, err
+	}
+	ev := CFFEvent{
+		Version: "1.0",
+		Context: &CFFContext{EventType: eventType},
+		Viewer:  &CFFViewer{IP: viewerIP},
+		Request: &req,
+	}
+
+	rest := sections[1:]
+	switch eventType {
+	case "viewer-request":
+	case "viewer-response":
+		if len(rest) == 0 || rest[0] == "" {
+			return nil, nil, fmt.Errorf("response is required for %s in the test case file", eventType)
+		}
+		resp, err := ParseResponse(rest[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		ev.Response = &resp
+		rest = rest[1:]
+	default:
+		return nil, nil, fmt.Errorf("invalid event type %s in the test case file", eventType)
+	}
+	if event, err = json.Marshal(ev); err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal event object, %w", err)
+	}
+
+	switch {
+	case len(rest) > 1:
+		return nil, nil, fmt.Errorf("too many sections in the test case file")
+	case len(rest) == 0 || rest[0] == "":
+		return event, nil, nil
+	}
+	var ex CFFExpect
+	if strings.HasPrefix(rest[0], "HTTP/") {
+		resp, err := ParseResponse(rest[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		ex.Reponse = &resp
+	} else {
+		req, err := ParseRequest(rest[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		ex.Request = &req
+	}
+	if expect, err = json.Marshal(ex); err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal expect object, %w", err)
+	}
+	return event, expect, nil
+}
+
+// splitCaseFile splits the text into the sections. Leading and trailing blank lines of each section are removed.
+func splitCaseFile(s string) []string {
+	var sections []string
+	var lines []string
+	flush := func() {
+		sections = append(sections, strings.TrimSpace(strings.Join(lines, "\n")))
+		lines = nil
+	}
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == CaseFileSeparator {
+			flush()
+			continue
+		}
+		lines = append(lines, line)
+	}
+	flush()
+	for i, sec := range sections {
+		if sec != "" {
+			// the HTTP text format requires the line terminator of the start line
+			sections[i] = sec + "\n"
+		}
+	}
+	return sections
+}
+
+// extractCaseHeaders removes the pseudo headers from the request text and returns their values.
+func extractCaseHeaders(text string) (string, string, string) {
+	eventType, viewerIP := "viewer-request", defaultCaseViewerIP
+	lines := strings.Split(text, "\n")
+	out := make([]string, 0, len(lines))
+	inHeader := true
+	for i, line := range lines {
+		if i == 0 || !inHeader {
+			out = append(out, line)
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			inHeader = false
+			out = append(out, line)
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			out = append(out, line)
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case caseHeaderEventType:
+			eventType = strings.TrimSpace(value)
+		case caseHeaderViewerIP:
+			viewerIP = strings.TrimSpace(value)
+		default:
+			out = append(out, line)
+		}
+	}
+	return strings.Join(out, "\n"), eventType, viewerIP
+}
@@ -0,0 +1,73 @@
+package cfft_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/fujiwara/cfft"
+)
+
+func TestParseCaseFile(t *testing.T) {
+	src := `GET /foo?a=1 HTTP/1.1
+Host: example.com
+CFFT-Viewer-IP: 192.0.2.1
+
+###
+
+GET /foo/index.html?a=1 HTTP/1.1
+Host: example.com
+`
+	eventBytes, expectBytes, err := cfft.ParseCaseFile([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event cfft.CFFEvent
+	if err := json.Unmarshal(eventBytes, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Context.EventType != "viewer-request" {
+		t.Errorf("unexpected event type: %s", event.Context.EventType)
+	}
+	if event.Viewer.IP != "192.0.2.1" {
+		t.Errorf("unexpected viewer ip: %s", event.Viewer.IP)
+	}
+	if event.Request.URI != "/foo?a=1" || event.Request.Headers["host"].Value != "example.com" {
+		t.Errorf("unexpected request: %#v", event.Request)
+	}
+	if _, ok := event.Request.Headers["cfft-viewer-ip"]; ok {
+		t.Error("pseudo header must be removed from the request")
+	}
+	var expect cfft.CFFExpect
+	if err := json.Unmarshal(expectBytes, &expect); err != nil {
+		t.Fatal(err)
+	}
+	if expect.Request == nil || expect.Request.URI != "/foo/index.html?a=1" {
+		t.Errorf("unexpected expect: %s", string(expectBytes))
+	}
+}
+
+func TestParseCaseFileWithoutExpect(t *testing.T) {
+	eventBytes, expectBytes, err := cfft.ParseCaseFile([]byte("GET / HTTP/1.1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expectBytes != nil {
+		t.Errorf("expect must be nil: %s", string(expectBytes))
+	}
+	if len(eventBytes) == 0 {
+		t.Error("event is empty")
+	}
+}
+
+func TestParseCaseFileInvalid(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"GET / HTTP/1.1\nCfft-Event-Type: origin-request\n",
+		"GET / HTTP/1.1\nCfft-Event-Type: viewer-response\n",
+		"GET / HTTP/1.1\n###\nGET / HTTP/1.1\n###\nGET / HTTP/1.1\n",
+	} {
+		if _, _, err := cfft.ParseCaseFile([]byte(src)); err == nil {
+			t.Errorf("expected error for %q", src)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"log/slog"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -31,20 +32,29 @@ type CFFT struct {
 	cloudfront *cloudfront.Client
 	cfkvs      *cloudfrontkeyvaluestore.Client
 	cfkvsArn   string
+	localKVS   WritableKeyValueStore
 	envs       map[string]string
 	stdout     io.Writer
+	stderr     io.Writer
 	runner     FunctionRunner
+	liveRunner FunctionRunner // runner of the LIVE stage function for --compare-live
+	liveETag   string
 }
 
 func (app *CFFT) SetStdout(w io.Writer) {
 	app.stdout = w
 }
 
+func (app *CFFT) SetStderr(w io.Writer) {
+	app.stderr = w
+}
+
 func New(ctx context.Context, config *Config) (*CFFT, error) {
 	app := &CFFT{
 		config: config,
 		envs:   map[string]string{},
 		stdout: os.Stdout,
+		stderr: os.Stderr,
 	}
 
 	// CloudFront region is fixed to us-east-1
@@ -54,7 +64,7 @@ func New(ctx context.Context, config *Config) (*CFFT, error) {
 	}
 	app.cloudfront = cloudfront.NewFromConfig(awscfg)
 	app.cfkvs = cloudfrontkeyvaluestore.NewFromConfig(awscfg)
-	app.runner = &CFFRunner{cloudfront: app.cloudfront}
+	app.runner = &CFFRunner{cloudfront: app.cloudfront, stage: Stage}
 
 	return app, nil
 }
@@ -130,35 +140,116 @@ func (app *CFFT) TestFunction(ctx context.Context, opt *TestCmd) error {
 	if err := opt.Setup(); err != nil {
 		return err
 	}
+	if opt.Watch {
+		return app.watchTest(ctx, opt)
+	}
+	return app.testFunction(ctx, opt, app.config.TestCases)
+}
+
+// testFunction runs the test cases selected from testCases by opt.
+func (app *CFFT) testFunction(ctx context.Context, opt *TestCmd, testCases []*TestCase) error {
 	code, err := app.config.FunctionCode(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to load function code, %w", err)
 	}
-	etag, err := app.prepareFunction(ctx, app.config.Name, code, opt.CreateIfMissing)
-	if err != nil {
-		return fmt.Errorf("failed to prepare function, %w", err)
+	var etag string
+	switch {
+	case app.runnerName(opt) == RunnerLocal:
+		if opt.CompareLive {
+			return fmt.Errorf("--compare-live is not supported by the local runner")
+		}
+		if opt.isLiveStage() {
+			return fmt.Errorf("--stage live is not supported by the local runner")
+		}
+		slog.Info("running test cases at local")
+		runner := NewLocalRunner(code, app.config.Runtime)
+		if kvs := app.testKVS(); kvs != nil {
+			runner.SetKVS(app.envs["KVS_ID"], kvs)
+		}
+		app.runner = runner
+	case opt.isLiveStage():
+		// test the published function as is. nothing is uploaded
+		if opt.CompareLive {
+			return fmt.Errorf("--compare-live cannot be used with --stage live")
+		}
+		// the LIVE stage is tested read-only. KVS fixtures would write to the KVS used by the production function
+		_, cases, _ := selectTestCases(opt, testCases)
+		for _, testCase := range cases {
+			if testCase.KVS != nil {
+				return fmt.Errorf("test case %s has kvs fixture, which cannot be used with --stage live", testCase.Identifier())
+			}
+		}
+		slog.Info(f("running test cases against LIVE function %s", app.config.Name))
+		if etag, err = app.liveFunctionETag(ctx); err != nil {
+			return err
+		}
+		app.runner = &CFFRunner{cloudfront: app.cloudfront, stage: types.FunctionStageLive}
+	default:
+		etag, err = app.prepareFunction(ctx, app.config.Name, code, opt.CreateIfMissing)
+		if err != nil {
+			return fmt.Errorf("failed to prepare function, %w", err)
+		}
+		if opt.CompareLive {
+			if err := app.prepareCompareLive(ctx); err != nil {
+				return err
+			}
+		}
 	}
+	return app.runTests(ctx, opt, etag, testCases)
+}
+
+// runTests runs the test cases selected from testCases by opt with the prepared runner,
+// and reports the results.
+func (app *CFFT) runTests(ctx context.Context, opt *TestCmd, etag string, testCases []*TestCase) error {
+	selected, cases, only := selectTestCases(opt, testCases)
 
-	var pass, fail int
+	var pass, fail, skip int
 	var errs []error
-	for _, testCase := range app.config.TestCases {
-		if !opt.ShouldRun(testCase.Identifier()) {
-			slog.Debug(f("skipping test case %s", testCase.Identifier()))
+	// diffs are written to stderr when a report is written to stdout
+	w := app.stdout
+	if hasStdoutReport(opt.reports) {
+		w = app.stderr
+	}
+	runResults := app.runTestCases(ctx, etag, cases, opt.Parallel, w)
+	if opt.Update {
+		if err := app.updateExpects(cases, runResults); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	// results of all the selected test cases including skipped ones, in order of the config
+	results := make([]*TestCaseResult, 0, len(selected))
+	for _, testCase := range selected {
+		if reason := testCase.skipReason(only); reason != "" {
+			slog.Info(f("test case %s skipped: %s", testCase.Identifier(), reason))
+			results = append(results, &TestCaseResult{Name: testCase.Identifier(), Skipped: reason})
 			continue
 		}
-		if err := app.RunTestCase(ctx, etag, testCase); err != nil {
+		results = append(results, runResults[0])
+		runResults = runResults[1:]
+	}
+	for _, r := range results {
+		switch r.Status() {
+		case TestCaseStatusFailed:
 			fail++
-			e := fmt.Errorf("failed to run test case %s, %w", testCase.Identifier(), err)
+			e := fmt.Errorf("failed to run test case %s, %w", r.Name, r.Err)
 			slog.Error(e.Error())
 			errs = append(errs, e)
-		} else {
+		case TestCaseStatusSkipped:
+			skip++
+		default:
 			pass++
 		}
 	}
+	summary := f("%d testcases passed", pass)
 	if fail > 0 {
-		slog.Info(f("%d testcases passed, %d testcases failed", pass, fail))
-	} else {
-		slog.Info(f("%d testcases passed", pass))
+		summary += f(", %d testcases failed", fail)
+	}
+	if skip > 0 {
+		summary += f(", %d testcases skipped", skip)
+	}
+	slog.Info(summary)
+	if err := app.writeReports(opt.reports, results); err != nil {
+		errs = append(errs, err)
 	}
 	if len(errs) > 0 {
 		return errors.Join(errs...)
@@ -166,6 +257,88 @@ func (app *CFFT) TestFunction(ctx context.Context, opt *TestCmd) error {
 	return nil
 }
 
+// selectTestCases returns the test cases selected from testCases by opt, and the ones to run among them.
+// The selected test cases which are not run are skipped by `skip` or `only`. only reports whether any selected test case has `only`.
+func selectTestCases(opt *TestCmd, testCases []*TestCase) (selected, cases []*TestCase, only bool) {
+	for _, testCase := range testCases {
+		if !opt.ShouldRun(testCase.Identifier()) || !opt.MatchTags(testCase.Tags) {
+			slog.Debug(f("skipping test case %s", testCase.Identifier()))
+			continue
+		}
+		selected = append(selected, testCase)
+		only = only || testCase.Only
+	}
+	for _, testCase := range selected {
+		if testCase.skipReason(only) == "" {
+			cases = append(cases, testCase)
+		}
+	}
+	return selected, cases, only
+}
+
+// runTestCases runs the test cases and returns the results in the same order as cases. The diffs are written to w.
+// If parallel is greater than 1, the test cases run concurrently and their outputs are grouped by test case.
+func (app *CFFT) runTestCases(ctx context.Context, etag string, cases []*TestCase, parallel int, w io.Writer) []*TestCaseResult {
+	results := make([]*TestCaseResult, len(cases))
+	if parallel <= 1 {
+		for i, cs := range cases {
+			results[i] = app.runTestCase(ctx, etag, cs, slog.Default(), w)
+		}
+		return results
+	}
+
+	slog.Info(f("running %d test cases, %d in parallel", len(cases), parallel))
+	recs := make([]*recorder, len(cases))
+	done := make([]chan struct{}, len(cases))
+	for i := range cases {
+		recs[i] = &recorder{}
+		done[i] = make(chan struct{})
+	}
+	// test cases with kvs fixture run exclusively, because they change the shared KVS
+	var kvsLock sync.RWMutex
+	sem := make(chan struct{}, parallel)
+	go func() {
+		for i, cs := range cases {
+			i, cs := i, cs
+			sem <- struct{}{}
+			go func() {
+				defer func() {
+					<-sem
+					close(done[i])
+				}()
+				if cs.KVS != nil {
+					kvsLock.Lock()
+					defer kvsLock.Unlock()
+				} else {
+					kvsLock.RLock()
+					defer kvsLock.RUnlock()
+				}
+				logger := slog.New(recs[i].Handler(slog.Default().Handler()))
+				results[i] = app.runTestCase(ctx, etag, cs, logger, recs[i])
+			}()
+		}
+	}()
+	// output the results in order
+	for i := range cases {
+		<-done[i]
+		if err := recs[i].Replay(ctx, w); err != nil {
+			slog.Warn(f("failed to output the result of test case %s, %s", cases[i].Identifier(), err))
+		}
+	}
+	return results
+}
+
+// runnerName returns the runner name specified by the flag or the config.
+func (app *CFFT) runnerName(opt *TestCmd) string {
+	if opt != nil && opt.Runner != "" {
+		return opt.Runner
+	}
+	if app.config != nil && app.config.Runner != "" {
+		return app.config.Runner
+	}
+	return RunnerRemote
+}
+
 func (app *CFFT) createFunction(ctx context.Context, name string, code []byte) (string, error) {
 	slog.Info(f("creating function %s...", name))
 	var kvsassociation *types.KeyValueStoreAssociations
@@ -296,22 +469,67 @@ func (app *CFFT) associateKVS(ctx context.Context, fc *types.FunctionConfig) (bo
 }
 
 func (app *CFFT) RunTestCase(ctx context.Context, etag string, cs *TestCase) error {
-	logger := slog.With("testcase", cs.Identifier())
+	return app.runTestCase(ctx, etag, cs, slog.Default(), app.stdout).Err
+}
 
-	output, err := app.runner.Run(ctx, app.config.Name, etag, cs.EventBytes(), logger)
-	if err != nil {
-		return fmt.Errorf("failed to run test function, %w", err)
+// runTestCase runs the test case and returns the result. The logs are written to logger and the diff is written to w.
+func (app *CFFT) runTestCase(ctx context.Context, etag string, cs *TestCase, logger *slog.Logger, w io.Writer) *TestCaseResult {
+	start := time.Now()
+	res, err := app.execTestCase(ctx, etag, cs, logger.With("testcase", cs.Identifier()), w)
+	return newTestCaseResult(cs, etag, time.Since(start), res, err)
+}
+
+// execTestCase executes the function for the test case and checks the result.
+// The result of the function is returned even if the check fails.
+func (app *CFFT) execTestCase(ctx context.Context, etag string, cs *TestCase, logger *slog.Logger, w io.Writer) (res *FunctionResult, err error) {
+	if cs.KVS != nil {
+		kvs := app.testKVS()
+		if kvs == nil {
+			return nil, errors.New("kvs is not configured, but the test case has kvs fixture")
+		}
+		var restore func(context.Context) error
+		restore, err = seedKVS(ctx, kvs, cs.KVS, logger)
+		defer func() {
+			// restore even if the context is canceled
+			if rerr := restore(context.WithoutCancel(ctx)); rerr != nil {
+				err = errors.Join(err, rerr)
+			}
+		}()
+		if err != nil {
+			return nil, fmt.Errorf("failed to seed kvs, %w", err)
+		}
+	}
+
+	res, err = app.runner.Run(ctx, app.config.Name, etag, cs.EventBytes(), logger)
+	var liveErr error
+	if app.liveRunner != nil {
+		liveErr = app.compareLive(ctx, cs, res, err, logger, w)
+	}
+	res, err = app.checkFunctionResult(ctx, cs, res, err, logger, w)
+	if liveErr != nil {
+		err = errors.Join(err, liveErr)
 	}
+	return res, err
+}
 
-	return cs.Run(ctx, output, logger)
+// checkFunctionResult checks the result of the function by the test case.
+func (app *CFFT) checkFunctionResult(ctx context.Context, cs *TestCase, res *FunctionResult, err error, logger *slog.Logger, w io.Writer) (*FunctionResult, error) {
+	if cs.ExpectError != "" {
+		return cs.checkFunctionError(res, err, logger)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to run test function, %w", err)
+	}
+	return res, cs.Run(ctx, res, logger, w)
 }
 
 type CFFRunner struct {
 	cloudfront *cloudfront.Client
+	stage      types.FunctionStage
 }
 
-func (r *CFFRunner) Run(ctx context.Context, name, etag string, event []byte, logger *slog.Logger) ([]byte, error) {
-	logger.Info("testing function", "etag", etag)
+func (r *CFFRunner) Run(ctx context.Context, name, etag string, event []byte, logger *slog.Logger) (*FunctionResult, error) {
+	logger.Info("testing function", "etag", etag, "stage", r.stage)
 	logger.Debug(f("event object: %s", string(event)))
 
 	// retry policy for returning 0 ComputeUtilization
@@ -325,7 +543,7 @@ func (r *CFFRunner) Run(ctx context.Context, name, etag string, event []byte, lo
 		res, err := r.cloudfront.TestFunction(ctx, &cloudfront.TestFunctionInput{
 			Name:        aws.String(name),
 			IfMatch:     aws.String(etag),
-			Stage:       Stage,
+			Stage:       r.stage,
 			EventObject: event,
 		})
 		if err != nil {
@@ -334,7 +552,15 @@ func (r *CFFRunner) Run(ctx context.Context, name, etag string, event []byte, lo
 		testResult = res.TestResult
 
 		if errMsg := aws.ToString(testResult.FunctionErrorMessage); errMsg != "" {
-			return retry.MarkPermanent(errors.New(errMsg))
+			for _, l := range testResult.FunctionExecutionLogs {
+				logger.Info(l, "from", name)
+			}
+			cu, _ := strconv.Atoi(aws.ToString(testResult.ComputeUtilization))
+			return retry.MarkPermanent(&FunctionError{
+				Message:            errMsg,
+				ComputeUtilization: cu,
+				Logs:               testResult.FunctionExecutionLogs,
+			})
 		}
 		if testResult.ComputeUtilization == nil || *testResult.ComputeUtilization == "" || *testResult.ComputeUtilization == "0" {
 			logger.Warn("ComputeUtilization: 0, retrying...")
@@ -350,23 +576,50 @@ func (r *CFFRunner) Run(ctx context.Context, name, etag string, event []byte, lo
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse compute utilization, %w", err)
 	}
+	logComputeUtilization(logger, cu)
+
+	for _, l := range testResult.FunctionExecutionLogs {
+		logger.Info(l, "from", name)
+	}
+	logger.Info("TestFunction API succeeded")
+
+	return &FunctionResult{
+		Output:             []byte(aws.ToString(testResult.FunctionOutput)),
+		ComputeUtilization: cu,
+		Logs:               testResult.FunctionExecutionLogs,
+	}, nil
+}
+
+// logComputeUtilization logs ComputeUtilization with the attributes args.
+func logComputeUtilization(logger *slog.Logger, cu int, args ...any) {
 	switch {
 	case 71 <= cu:
-		logger.Warn(f("ComputeUtilization: %d very close to or exceeds the maximum allowed time", cu))
+		logger.Warn(f("ComputeUtilization: %d very close to or exceeds the maximum allowed time", cu), args...)
 	case 51 <= cu:
-		logger.Warn(f("ComputeUtilization: %d nearing the maximum allowed time", cu))
+		logger.Warn(f("ComputeUtilization: %d nearing the maximum allowed time", cu), args...)
 	default:
-		logger.Info(f("ComputeUtilization: %d optimal", cu))
+		logger.Info(f("ComputeUtilization: %d optimal", cu), args...)
 	}
+}
 
-	for _, l := range testResult.FunctionExecutionLogs {
-		logger.Info(l, "from", name)
-	}
-	logger.Info("TestFunction API succeeded")
+// FunctionError is returned by FunctionRunner when the function throws an error.
+type FunctionError struct {
+	Message            string
+	ComputeUtilization int
+	Logs               []string
+}
+
+func (e *FunctionError) Error() string {
+	return e.Message
+}
 
-	return []byte(*testResult.FunctionOutput), nil
+// FunctionResult is the result of running the function by FunctionRunner.
+type FunctionResult struct {
+	Output             []byte
+	ComputeUtilization int
+	Logs               []string
 }
 
 type FunctionRunner interface {
-	Run(ctx context.Context, name, etag string, event []byte, logger *slog.Logger) ([]byte, error)
+	Run(ctx context.Context, name, etag string, event []byte, logger *slog.Logger) (*FunctionResult, error)
 }
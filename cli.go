@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"os"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 
@@ -15,15 +16,16 @@ import (
 )
 
 type CLI struct {
-	Test    *TestCmd    `cmd:"" help:"test function"`
-	Init    *InitCmd    `cmd:"" help:"initialize files"`
-	Diff    *DiffCmd    `cmd:"" help:"diff function code"`
-	Publish *PublishCmd `cmd:"" help:"publish function"`
-	KVS     *KVSCmd     `cmd:"" help:"manage key-value store"`
-	Render  *RenderCmd  `cmd:"" help:"render function code"`
-	Util    *UtilCmd    `cmd:"" help:"utility commands"`
-	TF      *TFCmd      `cmd:"tf" help:"output JSON for tf.json or external data source"`
-	Version *VersionCmd `cmd:"" help:"show version"`
+	Test     *TestCmd     `cmd:"" help:"test function"`
+	Init     *InitCmd     `cmd:"" help:"initialize files"`
+	Diff     *DiffCmd     `cmd:"" help:"diff function code"`
+	Publish  *PublishCmd  `cmd:"" help:"publish function"`
+	Rollback *RollbackCmd `cmd:"" help:"roll back function to the archived code"`
+	KVS      *KVSCmd      `cmd:"" help:"manage key-value store"`
+	Render   *RenderCmd   `cmd:"" help:"render function code"`
+	Util     *UtilCmd     `cmd:"" help:"utility commands"`
+	TF       *TFCmd       `cmd:"tf" help:"output JSON for tf.json or external data source"`
+	Version  *VersionCmd  `cmd:"" help:"show version"`
 
 	Config    string `short:"c" long:"config" help:"config file" default:"cfft.yaml"`
 	Debug     bool   `help:"enable debug log" default:"false"`
@@ -31,16 +33,34 @@ type CLI struct {
 }
 
 type TestCmd struct {
-	CreateIfMissing bool   `help:"create function if missing" default:"false"`
-	Run             string `help:"regexp to run test case names" default:""`
+	CreateIfMissing bool     `help:"create function if missing" default:"false"`
+	Run             string   `help:"regexp to run test case names" default:""`
+	Runner          string   `help:"function runner (remote,local). default is the runner in config or remote" default:"" enum:"remote,local,"`
+	Parallel        int      `help:"number of test cases to run in parallel" default:"1"`
+	Update          bool     `help:"update expect files with the actual function outputs" default:"false"`
+	Report          []string `help:"write test report as FORMAT=PATH (junit=report.xml, json=report.json). PATH - means stdout" placeholder:"FORMAT=PATH"`
+	Tags            []string `help:"run test cases which have any of the tags"`
+	ExcludeTags     []string `help:"do not run test cases which have any of the tags"`
+	Watch           bool     `help:"watch the function, config and test case files, and rerun the test cases on change" default:"false"`
+	CompareLive     bool     `help:"compare the outputs of DEVELOPMENT stage with LIVE stage" default:"false"`
+	Stage           string   `help:"stage of the function to test (development,live). live tests the published function without updating" default:"development" enum:"development,live"`
 
 	runRegex *regexp.Regexp
+	reports  []reportOption
 	once     sync.Once
 }
 
 func (cmd *TestCmd) Setup() error {
 	var err error
 	cmd.once.Do(func() {
+		if cmd.Parallel < 0 {
+			err = fmt.Errorf("parallel must not be negative: %d", cmd.Parallel)
+			return
+		}
+		cmd.reports, err = parseReportOptions(cmd.Report)
+		if err != nil {
+			return
+		}
 		if cmd.Run != "" {
 			cmd.runRegex, err = regexp.Compile(cmd.Run)
 			if err != nil {
@@ -51,6 +71,22 @@ func (cmd *TestCmd) Setup() error {
 	return err
 }
 
+func (cmd *TestCmd) isLiveStage() bool {
+	return cmd.Stage == "live"
+}
+
+// createKVSIfMissing reports whether the KVS should be created if missing for the command.
+// test --stage live never creates any resources.
+func (cmd *TestCmd) createKVSIfMissing(command string) bool {
+	if command == "test" && cmd.isLiveStage() {
+		if cmd.CreateIfMissing {
+			slog.Warn("--create-if-missing is ignored with --stage live")
+		}
+		return false
+	}
+	return cmd.CreateIfMissing
+}
+
 func (cmd *TestCmd) ShouldRun(name string) bool {
 	if cmd.runRegex == nil {
 		return true
@@ -58,6 +94,24 @@ func (cmd *TestCmd) ShouldRun(name string) bool {
 	return cmd.runRegex.MatchString(name)
 }
 
+// MatchTags reports whether the test case which has the tags is selected by --tags and --exclude-tags.
+func (cmd *TestCmd) MatchTags(tags []string) bool {
+	for _, t := range cmd.ExcludeTags {
+		if slices.Contains(tags, t) {
+			return false
+		}
+	}
+	if len(cmd.Tags) == 0 {
+		return true
+	}
+	for _, t := range cmd.Tags {
+		if slices.Contains(tags, t) {
+			return true
+		}
+	}
+	return false
+}
+
 type VersionCmd struct{}
 
 func RunCLI(ctx context.Context, args []string) error {
@@ -114,7 +168,12 @@ func (app *CFFT) Dispatch(ctx context.Context, cmds []string, cli *CLI) error {
 		return app.RunUtil(ctx, cmds[1], cli.Util)
 	}
 
-	if err := app.prepareKVS(ctx, cli.Test.CreateIfMissing); err != nil {
+	if cmds[0] == "test" && app.runnerName(cli.Test) == RunnerLocal && app.config.KVS != nil && app.config.KVS.Local != "" {
+		// local runner uses the local KVS instead of CloudFront KeyValueStore
+		if err := app.prepareLocalKVS(ctx); err != nil {
+			return err
+		}
+	} else if err := app.prepareKVS(ctx, cli.Test.createKVSIfMissing(cmds[0])); err != nil {
 		return err
 	}
 
@@ -132,6 +191,8 @@ func (app *CFFT) Dispatch(ctx context.Context, cmds []string, cli *CLI) error {
 		return app.DiffFunction(ctx, cli.Diff)
 	case "publish":
 		return app.PublishFunction(ctx, cli.Publish)
+	case "rollback":
+		return app.RollbackFunction(ctx, cli.Rollback)
 	case "render":
 		return app.Render(ctx, cli.Render)
 	case "kvs":
@@ -0,0 +1,109 @@
+package cfft
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/aereal/jsondiff"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+)
+
+// LiveDiffError is returned when the output of DEVELOPMENT stage is not equal to the output of LIVE stage.
+type LiveDiffError struct {
+	Diff string
+}
+
+func (e *LiveDiffError) Error() string {
+	return "outputs of LIVE and DEVELOPMENT are not equal"
+}
+
+// prepareCompareLive prepares the runner of the LIVE stage function to compare with.
+func (app *CFFT) prepareCompareLive(ctx context.Context) error {
+	etag, err := app.liveFunctionETag(ctx)
+	if err != nil {
+		return err
+	}
+	slog.Info(f("comparing outputs with LIVE function %s", app.config.Name))
+	app.liveRunner = &CFFRunner{cloudfront: app.cloudfront, stage: types.FunctionStageLive}
+	app.liveETag = etag
+	return nil
+}
+
+// liveFunctionETag returns the ETag of the LIVE stage function.
+func (app *CFFT) liveFunctionETag(ctx context.Context) (string, error) {
+	name := app.config.Name
+	res, err := app.cloudfront.DescribeFunction(ctx, &cloudfront.DescribeFunctionInput{
+		Name:  aws.String(name),
+		Stage: types.FunctionStageLive,
+	})
+	if err != nil {
+		var notFound *types.NoSuchFunctionExists
+		if errors.As(err, &notFound) {
+			return "", fmt.Errorf("function %s is not published to LIVE stage", name)
+		}
+		return "", fmt.Errorf("failed to describe LIVE function, %w", err)
+	}
+	return aws.ToString(res.ETag), nil
+}
+
+// compareLive runs the LIVE function with the event of the test case, and diffs the output with res and err of DEVELOPMENT.
+// The diff is written to w.
+func (app *CFFT) compareLive(ctx context.Context, cs *TestCase, res *FunctionResult, err error, logger *slog.Logger, w io.Writer) error {
+	dev, err := comparableResult(res, err)
+	if err != nil {
+		// DEVELOPMENT failed before running the function. the error is reported by the test case
+		return nil
+	}
+	liveLogger := logger.With("stage", string(types.FunctionStageLive))
+	liveRes, liveErr := app.liveRunner.Run(ctx, app.config.Name, app.liveETag, cs.EventBytes(), liveLogger)
+	live, err := comparableResult(liveRes, liveErr)
+	if err != nil {
+		return fmt.Errorf("failed to run LIVE function, %w", err)
+	}
+
+	logger.Info("comparing outputs of LIVE and DEVELOPMENT")
+	var options []jsondiff.Option
+	if cs.ignore != nil {
+		options = append(options, jsondiff.Ignore(cs.ignore))
+	}
+	diff, err := jsondiff.Diff(
+		&jsondiff.Input{Name: "live", X: live},
+		&jsondiff.Input{Name: "development", X: dev},
+		options...,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to diff, %w", err)
+	}
+	if diff == "" {
+		logger.Info("outputs of LIVE and DEVELOPMENT are equal")
+		return nil
+	}
+	fmt.Fprint(w, coloredDiff(diff))
+	if cs.LiveChange {
+		logger.Info("output is changed from LIVE as expected")
+		return nil
+	}
+	return &LiveDiffError{Diff: diff}
+}
+
+// comparableResult returns the output of the function as a map, or the error message if the function threw an error.
+func comparableResult(res *FunctionResult, err error) (any, error) {
+	if err != nil {
+		var ferr *FunctionError
+		if errors.As(err, &ferr) {
+			return map[string]any{"error": ferr.Message}, nil
+		}
+		return nil, err
+	}
+	var output CFFExpect
+	if err := json.Unmarshal(res.Output, &output); err != nil {
+		return nil, fmt.Errorf("failed to parse function output, %w", err)
+	}
+	return output.ToMap(), nil
+}
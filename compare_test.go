@@ -0,0 +1,202 @@
+package cfft_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+	"github.com/fujiwara/cfft"
+)
+
+var compareLiveTests = []struct {
+	name       string
+	live       string
+	dev        string
+	ignore     string
+	liveChange bool
+	err        bool
+}{
+	{
+		name: "same",
+		live: `function handler(event) { return event.request; }`,
+		dev:  `function handler(event) { var r = event.request; return r; }`,
+	},
+	{
+		name: "changed",
+		live: `function handler(event) { return event.request; }`,
+		dev:  `function handler(event) { event.request.uri = '/foo'; return event.request; }`,
+		err:  true,
+	},
+	{
+		name:       "expected change",
+		live:       `function handler(event) { return event.request; }`,
+		dev:        `function handler(event) { event.request.uri = '/foo'; return event.request; }`,
+		liveChange: true,
+	},
+	{
+		name:   "ignored",
+		live:   `function handler(event) { return event.request; }`,
+		dev:    `function handler(event) { event.request.uri = '/foo'; return event.request; }`,
+		ignore: ".request.uri",
+	},
+	{
+		name: "error changed",
+		live: `function handler(event) { throw new Error('live'); }`,
+		dev:  `function handler(event) { throw new Error('dev'); }`,
+		err:  true,
+	},
+}
+
+func TestCompareLive(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	conf, err := cfft.LoadConfig(ctx, "testdata/funcv2/cfft.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := cfft.New(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range compareLiveTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			app.SetStdout(&buf)
+			cs := &cfft.TestCase{
+				Name:       tt.name,
+				Event:      "testdata/funcv2/event.json",
+				Ignore:     tt.ignore,
+				LiveChange: tt.liveChange,
+			}
+			if strings.Contains(tt.dev, "throw") {
+				cs.ExpectError = "dev"
+			}
+			if err := cs.Setup(ctx, cfft.ReadFile); err != nil {
+				t.Fatal(err)
+			}
+			app.SetRunner(cfft.NewLocalRunner([]byte(tt.dev), types.FunctionRuntimeCloudfrontJs20))
+			app.SetLiveRunner(cfft.NewLocalRunner([]byte(tt.live), types.FunctionRuntimeCloudfrontJs20))
+			err := app.RunTestCase(ctx, "", cs)
+			if tt.err {
+				if err == nil || !strings.Contains(err.Error(), "outputs of LIVE and DEVELOPMENT are not equal") {
+					t.Errorf("expected live diff error, got %v", err)
+				}
+				if !strings.Contains(buf.String(), "live") {
+					t.Errorf("diff is not written: %s", buf.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLiveWithLocalRunner(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	conf, err := cfft.LoadConfig(ctx, "testdata/funcv2/cfft.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := cfft.New(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range []*cfft.TestCmd{
+		{Runner: cfft.RunnerLocal, Stage: "live"},
+		{Runner: cfft.RunnerLocal, CompareLive: true},
+	} {
+		if err := app.Dispatch(ctx, []string{"test"}, &cfft.CLI{Test: cmd}); err == nil {
+			t.Errorf("expected error for %#v", cmd)
+		}
+	}
+}
+
+// readOnlyKVS fails the test when any write is called.
+type readOnlyKVS struct {
+	cfft.MapKVS
+	t *testing.T
+}
+
+func (kvs *readOnlyKVS) Put(_ context.Context, key, _ string) error {
+	kvs.t.Errorf("unexpected put %s", key)
+	return errors.New("read only")
+}
+
+func (kvs *readOnlyKVS) Delete(_ context.Context, key string) error {
+	kvs.t.Errorf("unexpected delete %s", key)
+	return errors.New("read only")
+}
+
+func TestLiveStageReadOnly(t *testing.T) {
+	t.Setenv("KVS_ID", "kvs-id")
+	ctx := cfft.NewTestContext()
+	conf, err := cfft.LoadConfig(ctx, "testdata/true-client-ip/cfft.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := cfft.New(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.SetTestKVS(&readOnlyKVS{MapKVS: cfft.MapKVS{"127.0.0.1": "localhost"}, t: t})
+	cmd := &cfft.TestCmd{Runner: cfft.RunnerRemote, Stage: "live", CreateIfMissing: true}
+	err = app.TestFunction(ctx, cmd)
+	if err == nil || !strings.Contains(err.Error(), "kvs fixture") {
+		t.Errorf("expected kvs fixture error, got %v", err)
+	}
+	if cmd.CreateKVSIfMissing("test") {
+		t.Error("--create-if-missing must be ignored with --stage live")
+	}
+	if !(&cfft.TestCmd{CreateIfMissing: true}).CreateKVSIfMissing("test") {
+		t.Error("--create-if-missing must be kept for the development stage")
+	}
+}
+
+func TestLiveStageSkippedKVSFixture(t *testing.T) {
+	t.Setenv("KVS_ID", "kvs-id")
+	ctx := cfft.NewTestContext()
+	for _, tt := range []struct {
+		name  string
+		setup func(cases []*cfft.TestCase)
+	}{
+		{
+			name: "skip",
+			setup: func(cases []*cfft.TestCase) {
+				for _, cs := range cases[1:] {
+					cs.Skip = "writes kvs"
+				}
+			},
+		},
+		{
+			name: "only",
+			setup: func(cases []*cfft.TestCase) {
+				cases[0].Only = true
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, err := cfft.LoadConfig(ctx, "testdata/true-client-ip/cfft.yaml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// only the first test case runs, and it has no kvs fixture
+			conf.TestCases[0].KVS = nil
+			tt.setup(conf.TestCases)
+			app, err := cfft.New(ctx, conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			app.SetTestKVS(&readOnlyKVS{MapKVS: cfft.MapKVS{}, t: t})
+			app.SetCloudFront((&fakeCloudFront{liveETag: "E-LIVE"}).client())
+			err = app.TestFunction(ctx, &cfft.TestCmd{Runner: cfft.RunnerRemote, Stage: "live"})
+			// the fake does not support TestFunction, so the test case which runs fails
+			if err == nil || !strings.Contains(err.Error(), "TestFunctionInput") {
+				t.Errorf("expected the test case to run against LIVE, got %v", err)
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"text/template"
 
 	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
 	"github.com/goccy/go-yaml"
@@ -21,17 +22,27 @@ type Config struct {
 	Function  json.RawMessage       `json:"function" yaml:"function,omitempty"`
 	Runtime   types.FunctionRuntime `json:"runtime" yaml:"runtime"`
 	KVS       *KeyValueStoreConfig  `json:"kvs,omitempty" yaml:"kvs,omitempty"`
-	TestCases []*TestCase           `json:"testCases" yaml:"testCases"`
+	Runner    string                `json:"runner,omitempty" yaml:"runner,omitempty"`
+	TestCases TestCases             `json:"testCases" yaml:"testCases"`
+	Publish   *PublishConfig        `json:"publish,omitempty" yaml:"publish,omitempty"`
+	Archive   *ArchiveConfig        `json:"archive,omitempty" yaml:"archive,omitempty"`
 
 	function     ConfigFunction
 	functionCode []byte
 	dir          string
+	globs        []string // the globs of test case files
 	path         string
 	loader       *goconfig.Loader
 }
 
 // ReadFile supports jsonnet and yaml files. If the file is jsonnet or yaml, it will be evaluated and converted to json.
 func ReadFile(p string) ([]byte, error) {
+	return readFile(p, nil)
+}
+
+// readFile reads the file like ReadFile. envs overrides the environment variables in the templates.
+func readFile(p string, envs map[string]string) ([]byte, error) {
+	render := newTemplateLoader(envs).ReadWithEnvBytes
 	b, err := os.ReadFile(p)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file %s, %w", p, err)
@@ -39,19 +50,13 @@ func ReadFile(p string) ([]byte, error) {
 	switch filepath.Ext(p) {
 	case ".json", ".jsonnet":
 		vm := jsonnet.MakeVM()
-		return func() ([]byte, error) {
-			// change directory to the file's directory
-			// to resolve relative paths in jsonnet
-			cd, _ := os.Getwd()
-			defer os.Chdir(cd)
-			d, f := filepath.Dir(p), filepath.Base(p)
-			os.Chdir(d)
-			s, err := vm.EvaluateAnonymousSnippet(f, string(b))
-			if err != nil {
-				return nil, fmt.Errorf("failed to evaluate jsonnet %s, %w", p, err)
-			}
-			return goconfig.ReadWithEnvBytes([]byte(s))
-		}()
+		// resolve relative paths in jsonnet from the file's directory
+		vm.Importer(&jsonnet.FileImporter{JPaths: []string{filepath.Dir(p)}})
+		s, err := vm.EvaluateAnonymousSnippet(p, string(b))
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate jsonnet %s, %w", p, err)
+		}
+		return render([]byte(s))
 	case ".yaml", ".yml":
 		var v any
 		if err := yaml.Unmarshal(b, &v); err != nil {
@@ -61,10 +66,45 @@ func ReadFile(p string) ([]byte, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to convert yaml to json %s, %w", p, err)
 		}
-		return goconfig.ReadWithEnvBytes(b)
+		return render(b)
 	}
 	// otherwise, return as is
-	return goconfig.ReadWithEnvBytes(b)
+	return render(b)
+}
+
+// newTemplateLoader returns a template loader. envs overrides the environment variables
+// referred by env and must_env functions without changing the environment of the process.
+func newTemplateLoader(envs map[string]string) *goconfig.Loader {
+	loader := goconfig.New()
+	if len(envs) == 0 {
+		return loader
+	}
+	lookup := func(key string) (string, bool) {
+		if v, ok := envs[key]; ok {
+			return v, true
+		}
+		return os.LookupEnv(key)
+	}
+	loader.Funcs(template.FuncMap{
+		"env": func(keys ...string) string {
+			v := ""
+			for _, k := range keys {
+				v, _ = lookup(k)
+				if v != "" {
+					return v
+				}
+				v = k
+			}
+			return v
+		},
+		"must_env": func(key string) string {
+			if v, ok := lookup(key); ok {
+				return v
+			}
+			panic(fmt.Sprintf("environment variable %s is not defined", key))
+		},
+	})
+	return loader
 }
 
 // ReadFile reads file from the same directory as config file.
@@ -72,6 +112,13 @@ func (c *Config) ReadFile(p string) ([]byte, error) {
 	return ReadFile(filepath.Join(c.dir, p))
 }
 
+// readFileWithEnv returns a function which reads file from the same directory as config file with envs.
+func (c *Config) readFileWithEnv(envs map[string]string) func(string) ([]byte, error) {
+	return func(p string) ([]byte, error) {
+		return readFile(filepath.Join(c.dir, p), envs)
+	}
+}
+
 func (c *Config) FunctionCode(ctx context.Context) ([]byte, error) {
 	if c.functionCode != nil {
 		return c.functionCode, nil
@@ -137,9 +184,22 @@ func LoadConfig(ctx context.Context, path string) (*Config, error) {
 		return nil, fmt.Errorf("invalid runtime %s", config.Runtime)
 	}
 
+	// validate runner
+	switch config.Runner {
+	case "", RunnerRemote, RunnerLocal:
+		// ok
+	default:
+		return nil, fmt.Errorf("invalid runner %s", config.Runner)
+	}
+
+	testCases, err := config.discoverTestCases()
+	if err != nil {
+		return nil, err
+	}
+	config.TestCases = expandMatrix(testCases)
 	for i, tc := range config.TestCases {
 		tc.id = i
-		if err := tc.Setup(ctx, config.ReadFile); err != nil {
+		if err := tc.Setup(ctx, config.readFileWithEnv(tc.Env)); err != nil {
 			return nil, fmt.Errorf("failed to setup config %s, %w", tc.Name, err)
 		}
 	}
@@ -147,5 +207,6 @@ func LoadConfig(ctx context.Context, path string) (*Config, error) {
 }
 
 type KeyValueStoreConfig struct {
-	Name string `json:"name" yaml:"name"`
+	Name  string `json:"name" yaml:"name"`
+	Local string `json:"local,omitempty" yaml:"local,omitempty"`
 }
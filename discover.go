@@ -0,0 +1,202 @@
+package cfft
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// TestCases is the list of test cases.
+// An object which has glob, like `{"glob":"tests/**/*.yaml"}`, is also accepted as the list of the test case.
+type TestCases []*TestCase
+
+func (tcs *TestCases) UnmarshalJSON(b []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+		var tc TestCase
+		if err := json.Unmarshal(b, &tc); err != nil {
+			return err
+		}
+		if tc.Glob == "" {
+			return fmt.Errorf("testCases must be a list or an object which has glob")
+		}
+		*tcs = TestCases{&tc}
+		return nil
+	}
+	var cases []*TestCase
+	if err := json.Unmarshal(b, &cases); err != nil {
+		return err
+	}
+	*tcs = cases
+	return nil
+}
+
+// discoverTestCases replaces the test cases which have glob with the test cases read from the matched files.
+// The paths in the test case files are relative to the file, and the names are derived from the paths.
+func (c *Config) discoverTestCases() ([]*TestCase, error) {
+	cases := make([]*TestCase, 0, len(c.TestCases))
+	for _, tc := range c.TestCases {
+		if tc.Glob == "" {
+			cases = append(cases, tc)
+			continue
+		}
+		if field := tc.fieldWithGlob(); field != "" {
+			return nil, fmt.Errorf("test case with glob %s must not have %s. set it in the test case files", tc.Glob, field)
+		}
+		c.globs = append(c.globs, tc.Glob)
+		files, err := globFiles(c.dir, tc.Glob)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no test case files match %s", tc.Glob)
+		}
+		for _, file := range files {
+			cs, err := c.readTestCaseFile(file)
+			if err != nil {
+				return nil, err
+			}
+			cases = append(cases, cs)
+		}
+	}
+	return cases, nil
+}
+
+// fieldWithGlob returns the name of the field set with glob. The other fields of the test case with glob are not used.
+func (tc *TestCase) fieldWithGlob() string {
+	v := reflect.ValueOf(tc).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		if !sf.IsExported() || sf.Name == "Glob" {
+			continue
+		}
+		fv := v.Field(i)
+		switch fv.Kind() {
+		case reflect.Map, reflect.Slice:
+			if fv.Len() == 0 {
+				continue
+			}
+		default:
+			if fv.IsZero() {
+				continue
+			}
+		}
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		return name
+	}
+	return ""
+}
+
+// readTestCaseFile reads the test case file. file is relative to the config file.
+func (c *Config) readTestCaseFile(file string) (*TestCase, error) {
+	if isCaseFile(file) {
+		return &TestCase{
+			Name:   strings.TrimSuffix(filepath.ToSlash(file), CaseFileExt),
+			Event:  file,
+			source: file,
+		}, nil
+	}
+	b, err := c.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read test case file %s, %w", file, err)
+	}
+	var tc TestCase
+	if err := json.Unmarshal(b, &tc); err != nil {
+		return nil, fmt.Errorf("failed to parse test case file %s, %w", file, err)
+	}
+	if tc.Glob != "" {
+		return nil, fmt.Errorf("glob is not allowed in test case file %s", file)
+	}
+	if tc.Name == "" {
+		tc.Name = strings.TrimSuffix(filepath.ToSlash(file), filepath.Ext(file))
+	}
+	tc.source = file
+	dir := filepath.Dir(file)
+	for _, p := range []*string{&tc.Event, &tc.BaseEvent, &tc.Expect} {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+	return &tc, nil
+}
+
+// globFiles returns the files under dir which match the pattern, in lexical order.
+// The pattern is slash separated and relative to dir. `*` and `?` do not match `/`, and `**` matches any directories.
+func globFiles(dir, pattern string) ([]string, error) {
+	re, err := pathGlobToRegexp(filepath.ToSlash(filepath.Clean(pattern)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob %s, %w", pattern, err)
+	}
+	// walk only under the directory of the literal prefix of the pattern
+	root := dir
+	if prefix := globPrefix(filepath.ToSlash(filepath.Clean(pattern))); prefix != "" {
+		root = filepath.Join(dir, filepath.FromSlash(prefix))
+		if _, err := os.Stat(root); errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+	}
+	var files []string
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if re.MatchString(filepath.ToSlash(rel)) {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find test case files %s, %w", pattern, err)
+	}
+	return files, nil
+}
+
+// globPrefix returns the leading directories of the slash separated pattern which have no wildcards.
+func globPrefix(pattern string) string {
+	dirs := strings.Split(pattern, "/")
+	dirs = dirs[:len(dirs)-1]
+	for i, d := range dirs {
+		if strings.ContainsAny(d, "*?") {
+			return strings.Join(dirs[:i], "/")
+		}
+	}
+	return strings.Join(dirs, "/")
+}
+
+func pathGlobToRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; ch {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**/") {
+				b.WriteString("(?:.*/)?")
+				i += 2
+			} else if strings.HasPrefix(pattern[i:], "**") {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,83 @@
+package cfft_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/cfft"
+)
+
+func TestDiscoverTestCases(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	conf, err := cfft.LoadConfig(ctx, "testdata/discover/cfft.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names, events []string
+	for _, cs := range conf.TestCases {
+		names = append(names, cs.Identifier())
+		events = append(events, filepath.ToSlash(cs.Event))
+	}
+	if s := strings.Join(names, ","); s != "tests/index,sub-root" {
+		t.Errorf("unexpected test cases: %s", s)
+	}
+	if s := strings.Join(events, ","); s != "tests/index.json,tests/sub/event.json" {
+		t.Errorf("unexpected events: %s", s)
+	}
+
+	app, err := cfft.New(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli := &cfft.CLI{Test: &cfft.TestCmd{Runner: cfft.RunnerLocal, Run: "^sub-"}}
+	if err := app.Dispatch(ctx, []string{"test"}, cli); err != nil {
+		t.Errorf("failed to test discovered test cases: %v", err)
+	}
+}
+
+var globFilesTests = []struct {
+	pattern string
+	expect  string
+}{
+	{pattern: "tests/**/*.yaml", expect: "tests/index.yaml,tests/sub/root.yaml"},
+	{pattern: "tests/*.yaml", expect: "tests/index.yaml"},
+	{pattern: "**/*.json", expect: "tests/index.json,tests/sub/event.json"},
+	{pattern: "tests/sub/?oot.yaml", expect: "tests/sub/root.yaml"},
+	{pattern: "*.yml", expect: ""},
+	{pattern: "nothing/**/*.yaml", expect: ""},
+}
+
+func TestGlobFiles(t *testing.T) {
+	for _, tt := range globFilesTests {
+		files, err := cfft.GlobFiles("testdata/discover", tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range files {
+			files[i] = filepath.ToSlash(files[i])
+		}
+		if s := strings.Join(files, ","); s != tt.expect {
+			t.Errorf("unexpected files for %s: %s, expected %s", tt.pattern, s, tt.expect)
+		}
+	}
+}
+
+func TestDiscoverTestCasesWithOtherFields(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	dir := t.TempDir()
+	config := `name: discover
+function: function.js
+testCases:
+  - glob: "tests/*.yaml"
+    tags: [slow]
+`
+	if err := os.WriteFile(filepath.Join(dir, "cfft.yaml"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := cfft.LoadConfig(ctx, filepath.Join(dir, "cfft.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "must not have tags") {
+		t.Errorf("expected error for glob with tags, got %v", err)
+	}
+}
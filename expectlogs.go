@@ -0,0 +1,99 @@
+package cfft
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// LogExpectation is an expected line in the function logs.
+// It is a string which matches the line exactly, or an object which has regex or contains.
+type LogExpectation struct {
+	Line     string `json:"line,omitempty" yaml:"line,omitempty"`
+	Regex    string `json:"regex,omitempty" yaml:"regex,omitempty"`
+	Contains string `json:"contains,omitempty" yaml:"contains,omitempty"`
+
+	re *regexp.Regexp
+}
+
+func (e *LogExpectation) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		return json.Unmarshal(b, &e.Line)
+	}
+	type logExpectation LogExpectation
+	var x logExpectation
+	if err := json.Unmarshal(b, &x); err != nil {
+		return err
+	}
+	*e = LogExpectation(x)
+	return nil
+}
+
+func (e *LogExpectation) setup() error {
+	n := 0
+	for _, s := range []string{e.Line, e.Regex, e.Contains} {
+		if s != "" {
+			n++
+		}
+	}
+	if n != 1 {
+		return errors.New("expectLogs must be a string, or an object which has one of line, regex or contains")
+	}
+	if e.Regex != "" {
+		re, err := regexp.Compile(e.Regex)
+		if err != nil {
+			return fmt.Errorf("failed to compile regex %s, %w", e.Regex, err)
+		}
+		e.re = re
+	}
+	return nil
+}
+
+func (e *LogExpectation) String() string {
+	switch {
+	case e.re != nil:
+		return f("regex %s", e.Regex)
+	case e.Contains != "":
+		return f("contains %q", e.Contains)
+	default:
+		return f("%q", e.Line)
+	}
+}
+
+func (e *LogExpectation) match(line string) bool {
+	switch {
+	case e.re != nil:
+		return e.re.MatchString(line)
+	case e.Contains != "":
+		return strings.Contains(line, e.Contains)
+	default:
+		return line == e.Line
+	}
+}
+
+// checkLogs checks that the function logs have the lines matching expectLogs in order.
+// The other lines between the matched lines are allowed.
+func (c *TestCase) checkLogs(logs []string, logger *slog.Logger) error {
+	if len(c.ExpectLogs) == 0 {
+		return nil
+	}
+	i := 0
+	for _, e := range c.ExpectLogs {
+		found := false
+		for ; i < len(logs); i++ {
+			if e.match(logs[i]) {
+				found = true
+				i++
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("expected log line %s is not found in the function logs in order:\n%s", e, strings.Join(logs, "\n"))
+		}
+	}
+	logger.Info(f("%d expected log lines found", len(c.ExpectLogs)))
+	return nil
+}
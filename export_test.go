@@ -1,6 +1,11 @@
 package cfft
 
-import "context"
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+)
 
 func NewTestContext() context.Context {
 	return context.WithValue(context.Background(), testingKey, true)
@@ -13,6 +18,17 @@ var (
 	IsSameCode       = isSameCode
 	RemoveCFFTHeader = removeCFFTHeader
 	AddCFFTHeader    = addCFFTHeader
+	ParseLocalKVS    = parseLocalKVS
+	LocalKVSID       = localKVSID
+	SeedKVS          = seedKVS
+	WriteJUnitReport = writeJUnitReport
+	WriteJSONReport  = writeJSONReport
+	ExpandMatrix     = expandMatrix
+	GlobFiles        = globFiles
+	ParseCaseFile    = parseCaseFile
+	PatchEvent       = patchEvent
+	NewLocalArchive  = newLocalArchive
+	InstrumentSteps  = instrumentSteps
 )
 
 func (app *CFFT) Config() *Config {
@@ -30,3 +46,36 @@ func (tc *TestCase) GetEvent() *CFFEvent {
 func (tc *TestCase) GetExpect() *CFFExpect {
 	return tc.expect
 }
+
+func SetWatchInterval(interval, debounce time.Duration) {
+	watchInterval = interval
+	watchDebounce = debounce
+}
+
+func (app *CFFT) SetLiveRunner(r FunctionRunner) {
+	app.liveRunner = r
+}
+
+func (app *CFFT) ShouldTestBeforePublish(opt *PublishCmd) bool {
+	return app.shouldTestBeforePublish(opt)
+}
+
+func (app *CFFT) SetTestKVS(kvs WritableKeyValueStore) {
+	app.localKVS = kvs
+}
+
+func (cmd *TestCmd) CreateKVSIfMissing(command string) bool {
+	return cmd.createKVSIfMissing(command)
+}
+
+func (app *CFFT) TestBeforePublish(ctx context.Context, runner FunctionRunner, etag string, currentETag func(context.Context) (string, error)) error {
+	return app.testBeforePublish(ctx, runner, etag, currentETag)
+}
+
+func (app *CFFT) SetCloudFront(c *cloudfront.Client) {
+	app.cloudfront = c
+}
+
+func (r *LocalRunner) SetTimeout(timeout time.Duration) {
+	r.timeout = timeout
+}
@@ -23,7 +23,7 @@ type localRunner struct {
 	code []byte
 }
 
-func (r *localRunner) Run(ctx context.Context, name, _ string, event []byte, logger *slog.Logger) ([]byte, error) {
+func (r *localRunner) Run(ctx context.Context, name, _ string, event []byte, logger *slog.Logger) (*cfft.FunctionResult, error) {
 	logger.Info(fmt.Sprintf("running function %s at local", name))
 	code := r.code
 	code = append(code, []byte(fmt.Sprintf(runHandler, string(event)))...)
@@ -34,7 +34,7 @@ func (r *localRunner) Run(ctx context.Context, name, _ string, event []byte, log
 		logger.Error(string(out))
 		return nil, err
 	}
-	return out, nil
+	return &cfft.FunctionResult{Output: out, ComputeUtilization: 1}, nil
 }
 
 func TestLocalRunner(t *testing.T) {
@@ -3,12 +3,17 @@ package cfft
 import (
 	"bufio"
 	"context"
+	"crypto/md5"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"sort"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudfrontkeyvaluestore"
+	kvstypes "github.com/aws/aws-sdk-go-v2/service/cloudfrontkeyvaluestore/types"
 )
 
 type KVSCmd struct {
@@ -178,3 +183,195 @@ func formatKVSItem(item *KVSItem, format string) (string, error) {
 		return "", fmt.Errorf("unknown format %s", format)
 	}
 }
+
+// remoteKVS is a KeyValueStore backed by CloudFront KeyValueStore API.
+type remoteKVS struct {
+	client *cloudfrontkeyvaluestore.Client
+	arn    string
+}
+
+func (s *remoteKVS) Get(ctx context.Context, key string) (string, error) {
+	res, err := s.client.GetKey(ctx, &cloudfrontkeyvaluestore.GetKeyInput{
+		KvsARN: aws.String(s.arn),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var notFound *kvstypes.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			return "", ErrKVSKeyNotFound
+		}
+		return "", fmt.Errorf("failed to get key, %w", err)
+	}
+	return aws.ToString(res.Value), nil
+}
+
+func (s *remoteKVS) Put(ctx context.Context, key, value string) error {
+	res, err := s.client.DescribeKeyValueStore(ctx, &cloudfrontkeyvaluestore.DescribeKeyValueStoreInput{
+		KvsARN: aws.String(s.arn),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe key value store, %w", err)
+	}
+	if _, err := s.client.PutKey(ctx, &cloudfrontkeyvaluestore.PutKeyInput{
+		KvsARN:  aws.String(s.arn),
+		IfMatch: res.ETag,
+		Key:     aws.String(key),
+		Value:   aws.String(value),
+	}); err != nil {
+		return fmt.Errorf("failed to put key, %w", err)
+	}
+	return nil
+}
+
+func (s *remoteKVS) Delete(ctx context.Context, key string) error {
+	res, err := s.client.DescribeKeyValueStore(ctx, &cloudfrontkeyvaluestore.DescribeKeyValueStoreInput{
+		KvsARN: aws.String(s.arn),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe key value store, %w", err)
+	}
+	if _, err := s.client.DeleteKey(ctx, &cloudfrontkeyvaluestore.DeleteKeyInput{
+		KvsARN:  aws.String(s.arn),
+		IfMatch: res.ETag,
+		Key:     aws.String(key),
+	}); err != nil {
+		return fmt.Errorf("failed to delete key, %w", err)
+	}
+	return nil
+}
+
+// testKVS returns the KeyValueStore used by the test cases. It returns nil if no KVS is configured.
+func (app *CFFT) testKVS() WritableKeyValueStore {
+	if app.localKVS != nil {
+		return app.localKVS
+	}
+	if app.cfkvsArn != "" {
+		return &remoteKVS{client: app.cfkvs, arn: app.cfkvsArn}
+	}
+	return nil
+}
+
+// seedKVS puts and deletes the keys of the test case fixture.
+// It returns a function which restores the previous values of the keys.
+func seedKVS(ctx context.Context, kvs WritableKeyValueStore, seed *TestCaseKVS, logger *slog.Logger) (func(context.Context) error, error) {
+	type prev struct {
+		key    string
+		value  string
+		exists bool
+	}
+	var prevs []prev
+	restore := func(ctx context.Context) error {
+		var errs []error
+		// restore in reverse order
+		for i := len(prevs) - 1; i >= 0; i-- {
+			p := prevs[i]
+			var err error
+			if p.exists {
+				logger.Debug(f("restoring kvs key %s", p.key))
+				err = kvs.Put(ctx, p.key, p.value)
+			} else {
+				logger.Debug(f("removing kvs key %s", p.key))
+				err = kvs.Delete(ctx, p.key)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to restore kvs key %s, %w", p.key, err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+	save := func(key string) (bool, error) {
+		v, err := kvs.Get(ctx, key)
+		switch {
+		case errors.Is(err, ErrKVSKeyNotFound):
+			prevs = append(prevs, prev{key: key})
+			return false, nil
+		case err != nil:
+			return false, err
+		}
+		prevs = append(prevs, prev{key: key, value: v, exists: true})
+		return true, nil
+	}
+
+	keys := make([]string, 0, len(seed.Put))
+	for k := range seed.Put {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, err := save(k); err != nil {
+			return restore, fmt.Errorf("failed to get kvs key %s, %w", k, err)
+		}
+		logger.Debug(f("putting kvs key %s", k))
+		if err := kvs.Put(ctx, k, kvsValue(seed.Put[k])); err != nil {
+			return restore, fmt.Errorf("failed to put kvs key %s, %w", k, err)
+		}
+	}
+	for _, k := range seed.Delete {
+		exists, err := save(k)
+		if err != nil {
+			return restore, fmt.Errorf("failed to get kvs key %s, %w", k, err)
+		}
+		if !exists {
+			continue
+		}
+		logger.Debug(f("deleting kvs key %s", k))
+		if err := kvs.Delete(ctx, k); err != nil {
+			return restore, fmt.Errorf("failed to delete kvs key %s, %w", k, err)
+		}
+	}
+	return restore, nil
+}
+
+// kvsValue returns the value stored in the KVS. Values which are not strings are stored as JSON strings.
+func kvsValue(v json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(v, &s); err == nil {
+		return s
+	}
+	return string(v)
+}
+
+// prepareLocalKVS loads the local KVS file and sets a stable fake KVS_ID.
+func (app *CFFT) prepareLocalKVS(ctx context.Context) error {
+	name, path := app.config.KVS.Name, app.config.KVS.Local
+	b, err := app.config.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read local kvs file %s, %w", path, err)
+	}
+	kvs, err := parseLocalKVS(b)
+	if err != nil {
+		return fmt.Errorf("failed to parse local kvs file %s, %w", path, err)
+	}
+	slog.Info(f("using local kvs %s loaded from %s (%d keys)", name, path, len(kvs)))
+	app.localKVS = kvs
+	app.envs["KVS_ID"] = localKVSID(name)
+	app.envs["KVS_NAME"] = name
+	return nil
+}
+
+// localKVSID returns a fake KVS id which is stable for the name.
+func localKVSID(name string) string {
+	h := md5.Sum([]byte(name))
+	return fmt.Sprintf("%x-%x-%x-%x-%x", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
+
+// parseLocalKVS parses a local KVS file. The file is an object of key values or an array of KVSItem.
+// Values which are not strings are stored as JSON strings.
+func parseLocalKVS(b []byte) (MapKVS, error) {
+	kvs := MapKVS{}
+	var items []KVSItem
+	if err := json.Unmarshal(b, &items); err == nil {
+		for _, item := range items {
+			kvs[item.Key] = item.Value
+		}
+		return kvs, nil
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	for k, v := range m {
+		kvs[k] = kvsValue(v)
+	}
+	return kvs, nil
+}
@@ -0,0 +1,83 @@
+package cfft_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/cfft"
+)
+
+func TestSeedKVS(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	kvs := cfft.MapKVS{"foo": "original", "bar": "to be deleted"}
+	seed := &cfft.TestCaseKVS{
+		Put: map[string]json.RawMessage{
+			"foo": json.RawMessage(`"seeded"`),
+			"baz": json.RawMessage(`{"x":1}`),
+		},
+		Delete: []string{"bar", "not-exists"},
+	}
+	restore, err := cfft.SeedKVS(ctx, kvs, seed, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeded := cfft.MapKVS{"foo": "seeded", "baz": `{"x":1}`}
+	if len(kvs) != len(seeded) {
+		t.Errorf("unexpected seeded kvs: %v", kvs)
+	}
+	for k, v := range seeded {
+		if kvs[k] != v {
+			t.Errorf("unexpected seeded value of %s: %q, expected %q", k, kvs[k], v)
+		}
+	}
+
+	if err := restore(ctx); err != nil {
+		t.Fatal(err)
+	}
+	restored := cfft.MapKVS{"foo": "original", "bar": "to be deleted"}
+	if len(kvs) != len(restored) {
+		t.Errorf("unexpected restored kvs: %v", kvs)
+	}
+	for k, v := range restored {
+		if kvs[k] != v {
+			t.Errorf("unexpected restored value of %s: %q, expected %q", k, kvs[k], v)
+		}
+	}
+}
+
+// undeletableKVS fails to delete keys, so the keys put by a fixture cannot be restored.
+type undeletableKVS struct {
+	cfft.MapKVS
+}
+
+func (kvs undeletableKVS) Delete(_ context.Context, key string) error {
+	return errors.New("delete failed")
+}
+
+func TestRunTestCaseKVSRestoreError(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	conf, err := cfft.LoadConfig(ctx, "testdata/funcv2/cfft.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := cfft.New(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := app.Config().FunctionCode(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.SetRunner(cfft.NewLocalRunner(code, app.Config().Runtime))
+	app.SetTestKVS(undeletableKVS{MapKVS: cfft.MapKVS{}})
+	cs := app.Config().TestCases[0]
+	cs.KVS = &cfft.TestCaseKVS{Put: map[string]json.RawMessage{"foo": json.RawMessage(`"bar"`)}}
+	err = app.RunTestCase(ctx, "", cs)
+	if err == nil || !strings.Contains(err.Error(), "failed to restore kvs key foo") {
+		t.Errorf("expected restore error, got %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package cfft
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+	"github.com/dop251/goja"
+)
+
+const (
+	RunnerRemote = "remote"
+	RunnerLocal  = "local"
+)
+
+// localComputeBudget is the execution time on CloudFront which is regarded as ComputeUtilization 100.
+const localComputeBudget = 2 * time.Millisecond
+
+// localExecutionTimeout is the limit of the execution time in the local runner.
+// CloudFront aborts the function which exceeds the compute budget, so the local runner aborts it too.
+// The limit is generous because the execution time depends on the machine and its load.
+const localExecutionTimeout = 1000 * localComputeBudget
+
+// errExecutionTimeout interrupts the function code which exceeds localExecutionTimeout.
+var errExecutionTimeout = fmt.Errorf("the function exceeded the maximum allowed execution time (%s) in the local runner", localExecutionTimeout)
+
+// LocalRunner runs the function code in an embedded JavaScript engine without calling CloudFront API.
+type LocalRunner struct {
+	code    []byte
+	runtime types.FunctionRuntime
+	kvs     KeyValueStore
+	kvsID   string
+	timeout time.Duration
+}
+
+func NewLocalRunner(code []byte, runtime types.FunctionRuntime) *LocalRunner {
+	return &LocalRunner{
+		code:    code,
+		runtime: runtime,
+		timeout: localExecutionTimeout,
+	}
+}
+
+// SetKVS sets the KeyValueStore returned by cf.kvs() in the function code.
+func (r *LocalRunner) SetKVS(id string, kvs KeyValueStore) {
+	r.kvsID = id
+	r.kvs = kvs
+}
+
+func (r *LocalRunner) Run(ctx context.Context, name, _ string, event []byte, logger *slog.Logger) (*FunctionResult, error) {
+	logger.Info("testing function at local", "runtime", r.runtime)
+	logger.Debug(f("event object: %s", string(event)))
+
+	vm := goja.New()
+	var logs []string
+	console := vm.NewObject()
+	console.Set("log", func(call goja.FunctionCall) goja.Value {
+		args := make([]string, 0, len(call.Arguments))
+		for _, a := range call.Arguments {
+			args = append(args, a.String())
+		}
+		logs = append(logs, strings.Join(args, " "))
+		return goja.Undefined()
+	})
+	vm.Set("console", console)
+
+	// abort the execution when the context is canceled or the execution takes too long
+	ctx, cancel := context.WithTimeoutCause(ctx, r.timeout, errExecutionTimeout)
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() {
+		vm.Interrupt(context.Cause(ctx))
+	})
+	defer stop()
+
+	output, steps, err := r.run(ctx, vm, name, event, logger)
+	if err != nil {
+		for _, l := range logs {
+			logger.Info(l, "from", name)
+		}
+		var ferr *FunctionError
+		if errors.As(err, &ferr) {
+			ferr.Logs = logs
+		}
+		return nil, fmt.Errorf("failed to test function, %w", err)
+	}
+	cu := estimateComputeUtilization(steps)
+	logComputeUtilization(logger, cu, "estimated", true)
+	for _, l := range logs {
+		logger.Info(l, "from", name)
+	}
+	logger.Info("local test succeeded")
+	return &FunctionResult{
+		Output:             output,
+		ComputeUtilization: cu,
+		Logs:               logs,
+	}, nil
+}
+
+// run runs the function code and returns the output and the steps executed in the code.
+func (r *LocalRunner) run(ctx context.Context, vm *goja.Runtime, name string, event []byte, logger *slog.Logger) ([]byte, int64, error) {
+	var ev map[string]any
+	if err := json.Unmarshal(event, &ev); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse event object, %w", err)
+	}
+	var eventType string
+	if c, ok := ev["context"].(map[string]any); ok {
+		eventType, _ = c["eventType"].(string)
+	}
+	r.registerModules(ctx, vm, eventType, logger)
+	if r.runtime == types.FunctionRuntimeCloudfrontJs10 {
+		// Promise is not available in cloudfront-js-1.0
+		vm.GlobalObject().Delete("Promise")
+	}
+
+	if err := checkRuntimeRestrictions(name, string(r.code), r.runtime); err != nil {
+		return nil, 0, err
+	}
+	code, err := instrumentSteps(name, rewriteImports(string(r.code)))
+	if err != nil {
+		return nil, 0, err
+	}
+	prog, err := goja.Compile(name, code, false)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to compile function code, %w", err)
+	}
+	vm.Set(stepCounter, 0)
+	if _, err := vm.RunProgram(prog); err != nil {
+		return nil, 0, jsError(err)
+	}
+	// handler may be declared by const or let, so it is not always a property of the global object
+	h, err := vm.RunString("handler")
+	if err != nil {
+		return nil, 0, jsError(err)
+	}
+	handler, ok := goja.AssertFunction(h)
+	if !ok {
+		return nil, 0, &FunctionError{Message: "handler is not a function"}
+	}
+
+	eventObj, err := jsonToValue(vm, event)
+	if err != nil {
+		return nil, 0, err
+	}
+	res, err := handler(goja.Undefined(), eventObj)
+	if err != nil {
+		return nil, 0, jsError(err)
+	}
+	// async handler returns a promise. All jobs are already processed when the call returns.
+	if p, ok := res.Export().(*goja.Promise); ok {
+		switch p.State() {
+		case goja.PromiseStateFulfilled:
+			res = p.Result()
+		case goja.PromiseStateRejected:
+			return nil, 0, &FunctionError{Message: p.Result().String()}
+		default:
+			return nil, 0, &FunctionError{Message: "the promise returned by handler is not settled"}
+		}
+	}
+	steps := vm.Get(stepCounter).ToInteger()
+	if goja.IsUndefined(res) || goja.IsNull(res) {
+		return nil, 0, &FunctionError{Message: "handler returned no value"}
+	}
+	b, err := valueToJSON(vm, res)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	key := "request"
+	if eventType == "viewer-response" || res.ToObject(vm).Get("statusCode") != nil {
+		key = "response"
+	}
+	output, err := json.Marshal(map[string]json.RawMessage{key: b})
+	if err != nil {
+		return nil, 0, err
+	}
+	return output, steps, nil
+}
+
+func jsonToValue(vm *goja.Runtime, b []byte) (goja.Value, error) {
+	parse, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("parse"))
+	v, err := parse(goja.Undefined(), vm.ToValue(string(b)))
+	if err != nil {
+		return nil, jsError(err)
+	}
+	return v, nil
+}
+
+func valueToJSON(vm *goja.Runtime, v goja.Value) ([]byte, error) {
+	stringify, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("stringify"))
+	s, err := stringify(goja.Undefined(), v)
+	if err != nil {
+		return nil, jsError(err)
+	}
+	return []byte(s.String()), nil
+}
+
+// jsError converts an error thrown by JavaScript code into a plain error message like the CloudFront API does.
+func jsError(err error) error {
+	var ex *goja.Exception
+	if errors.As(err, &ex) {
+		return &FunctionError{Message: ex.Value().String()}
+	}
+	var ie *goja.InterruptedError
+	if errors.As(err, &ie) {
+		if ie.Value() == errExecutionTimeout {
+			// fails the test case as the edge does
+			return &FunctionError{Message: errExecutionTimeout.Error()}
+		}
+		return fmt.Errorf("function execution is interrupted, %v", ie.Value())
+	}
+	return err
+}
@@ -0,0 +1,136 @@
+package cfft
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/parser"
+)
+
+// localComputeSteps is the number of steps in the local runner which is regarded as ComputeUtilization 100.
+// A step is a call of a function or an iteration of a loop in the function code. Counting steps is deterministic,
+// unlike the execution time, so maxComputeUtilization is checked by the local runner as well as the remote runner.
+// It is calibrated roughly to the results of TestFunction API, so ComputeUtilization of the local runner is only an estimate.
+const localComputeSteps = 20000
+
+// stepCounter is the global variable which counts the steps in the instrumented function code.
+const stepCounter = "__cfftSteps"
+
+// estimateComputeUtilization estimates ComputeUtilization from the steps counted in the local runner.
+func estimateComputeUtilization(steps int64) int {
+	cu := int(math.Ceil(float64(steps) / localComputeSteps * 100))
+	if cu < 1 {
+		return 1
+	}
+	return cu
+}
+
+type insertion struct {
+	pos   int
+	text  string
+	close bool
+	seq   int
+}
+
+// instrumentSteps inserts the increments of stepCounter at the start of each function body and loop body.
+// Nothing is inserted across lines, so the line numbers of the code are kept.
+func instrumentSteps(name, code string) (string, error) {
+	prog, err := parser.ParseFile(nil, name, code, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse function code, %w", err)
+	}
+	base := prog.File.Base()
+	var ins []insertion
+	add := func(pos int, text string, close bool) {
+		ins = append(ins, insertion{pos: pos, text: text, close: close, seq: len(ins)})
+	}
+	step := stepCounter + "++;"
+	// after returns the offset after the statement including the following semicolon
+	after := func(n ast.Node) int {
+		pos := int(n.Idx1()) - base
+		for i := pos; i < len(code); i++ {
+			switch code[i] {
+			case ' ', '\t':
+				continue
+			case ';':
+				return i + 1
+			}
+			break
+		}
+		return pos
+	}
+	functionBody := func(b *ast.BlockStatement) {
+		pos := int(b.LeftBrace) - base + 1
+		// keep the directive prologue ("use strict") at the start of the body
+		for _, st := range b.List {
+			es, ok := st.(*ast.ExpressionStatement)
+			if !ok {
+				break
+			}
+			if _, ok := es.Expression.(*ast.StringLiteral); !ok {
+				break
+			}
+			pos = after(es)
+		}
+		add(pos, step, false)
+	}
+	loopBody := func(body ast.Statement) {
+		if b, ok := body.(*ast.BlockStatement); ok {
+			add(int(b.LeftBrace)-base+1, step, false)
+			return
+		}
+		add(int(body.Idx0())-base, "{"+step, false)
+		add(after(body), "}", true)
+	}
+	walkAST(prog.Body, func(n ast.Node) {
+		switch n := n.(type) {
+		case *ast.FunctionLiteral:
+			functionBody(n.Body)
+		case *ast.ArrowFunctionLiteral:
+			switch b := n.Body.(type) {
+			case *ast.BlockStatement:
+				functionBody(b)
+			case *ast.ExpressionBody:
+				add(int(b.Idx0())-base, "("+stepCounter+"++,", false)
+				add(int(b.Idx1())-base, ")", true)
+			}
+		case *ast.ForStatement:
+			loopBody(n.Body)
+		case *ast.ForInStatement:
+			loopBody(n.Body)
+		case *ast.ForOfStatement:
+			loopBody(n.Body)
+		case *ast.WhileStatement:
+			loopBody(n.Body)
+		case *ast.DoWhileStatement:
+			loopBody(n.Body)
+		}
+	})
+
+	// at the same position, the closings of the preceding nodes come first, and outer nodes enclose inner ones
+	sort.SliceStable(ins, func(i, j int) bool {
+		a, b := ins[i], ins[j]
+		if a.pos != b.pos {
+			return a.pos < b.pos
+		}
+		if a.close != b.close {
+			return a.close
+		}
+		if a.close {
+			return a.seq > b.seq
+		}
+		return a.seq < b.seq
+	})
+	var sb strings.Builder
+	last := 0
+	for _, in := range ins {
+		sb.WriteString(code[last:in.pos])
+		sb.WriteString(in.text)
+		last = in.pos
+	}
+	sb.WriteString(code[last:])
+	return sb.String(), nil
+}
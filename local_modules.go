@@ -0,0 +1,491 @@
+package cfft
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"log/slog"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+	"github.com/dop251/goja"
+)
+
+// ErrKVSKeyNotFound is returned by KeyValueStore.Get when the key does not exist.
+var ErrKVSKeyNotFound = errors.New("KVS key does not exist")
+
+// KeyValueStore is a store used by cf.kvs() in the local runner.
+type KeyValueStore interface {
+	Get(ctx context.Context, key string) (string, error)
+}
+
+// WritableKeyValueStore is a KeyValueStore which can put and delete keys. It is used to seed KVS fixtures of test cases.
+type WritableKeyValueStore interface {
+	KeyValueStore
+	Put(ctx context.Context, key, value string) error
+	Delete(ctx context.Context, key string) error
+}
+
+// MapKVS is a KeyValueStore backed by a map.
+type MapKVS map[string]string
+
+func (m MapKVS) Get(_ context.Context, key string) (string, error) {
+	if v, ok := m[key]; ok {
+		return v, nil
+	}
+	return "", ErrKVSKeyNotFound
+}
+
+func (m MapKVS) Put(_ context.Context, key, value string) error {
+	m[key] = value
+	return nil
+}
+
+func (m MapKVS) Delete(_ context.Context, key string) error {
+	delete(m, key)
+	return nil
+}
+
+var importRegexp = regexp.MustCompile(`(?m)^[ \t]*import\s+(.+?)\s+from\s+['"]([^'"]+)['"][ \t]*;?`)
+
+var importAsRegexp = regexp.MustCompile(`\s+as\s+`)
+
+// rewriteImports rewrites import statements to require() calls.
+// The embedded engine does not support ES modules. Each statement is rewritten in the same line to keep line numbers.
+func rewriteImports(code string) string {
+	return importRegexp.ReplaceAllStringFunc(code, func(s string) string {
+		m := importRegexp.FindStringSubmatch(s)
+		binding, module := strings.TrimSpace(m[1]), m[2]
+		switch {
+		case strings.HasPrefix(binding, "* as "):
+			binding = strings.TrimSpace(strings.TrimPrefix(binding, "* as "))
+		case strings.HasPrefix(binding, "{"):
+			// import { a, b as c } from 'module' -> var { a, b: c } = require('module')
+			binding = importAsRegexp.ReplaceAllString(binding, ": ")
+		}
+		return fmt.Sprintf("var %s = require(%q);", binding, module)
+	})
+}
+
+// registerModules defines require() which returns the built-in modules of CloudFront Functions.
+func (r *LocalRunner) registerModules(ctx context.Context, vm *goja.Runtime, eventType string, logger *slog.Logger) {
+	modules := map[string]func() *goja.Object{
+		"crypto":      func() *goja.Object { return newCryptoModule(vm) },
+		"querystring": func() *goja.Object { return newQueryStringModule(vm) },
+	}
+	if r.runtime != types.FunctionRuntimeCloudfrontJs10 {
+		modules["cloudfront"] = func() *goja.Object { return r.newCloudFrontModule(ctx, vm, eventType, logger) }
+	}
+	registerGlobals(vm)
+	loaded := map[string]*goja.Object{}
+	vm.Set("require", func(name string) *goja.Object {
+		if m, ok := loaded[name]; ok {
+			return m
+		}
+		newModule, ok := modules[name]
+		if !ok {
+			throwError(vm, "Cannot find module '%s'", name)
+		}
+		m := newModule()
+		loaded[name] = m
+		return m
+	})
+}
+
+// registerGlobals defines the global functions of CloudFront Functions which the embedded engine does not have.
+func registerGlobals(vm *goja.Runtime) {
+	vm.Set("btoa", func(s string) string {
+		b := make([]byte, 0, len(s))
+		for _, c := range s {
+			if c > 0xff {
+				throwError(vm, "Invalid character: btoa() accepts only Latin1 characters")
+			}
+			b = append(b, byte(c))
+		}
+		return base64.StdEncoding.EncodeToString(b)
+	})
+	vm.Set("atob", func(s string) string {
+		s = strings.Map(func(c rune) rune {
+			switch c {
+			case ' ', '\t', '\n', '\f', '\r':
+				return -1
+			}
+			return c
+		}, s)
+		if len(s)%4 == 0 {
+			s = strings.TrimSuffix(strings.TrimSuffix(s, "="), "=")
+		}
+		b, err := base64.RawStdEncoding.DecodeString(s)
+		if err != nil {
+			throwError(vm, "Invalid character: atob() accepts only base64 encoded string")
+		}
+		// returns a byte string like digest() without encoding
+		r := make([]rune, len(b))
+		for i, c := range b {
+			r[i] = rune(c)
+		}
+		return string(r)
+	})
+}
+
+// throwError throws an Error object to JavaScript code.
+func throwError(vm *goja.Runtime, format string, args ...any) {
+	e, err := vm.New(vm.Get("Error"), vm.ToValue(fmt.Sprintf(format, args...)))
+	if err != nil {
+		panic(err)
+	}
+	panic(e)
+}
+
+func newCryptoModule(vm *goja.Runtime) *goja.Object {
+	m := vm.NewObject()
+	m.Set("createHash", func(algorithm string) *goja.Object {
+		newHash := hashFunc(vm, algorithm)
+		return newHashObject(vm, newHash())
+	})
+	m.Set("createHmac", func(algorithm string, key string) *goja.Object {
+		newHash := hashFunc(vm, algorithm)
+		return newHashObject(vm, hmac.New(newHash, []byte(key)))
+	})
+	return m
+}
+
+func hashFunc(vm *goja.Runtime, algorithm string) func() hash.Hash {
+	switch strings.ToLower(algorithm) {
+	case "md5":
+		return md5.New
+	case "sha1":
+		return sha1.New
+	case "sha256":
+		return sha256.New
+	}
+	throwError(vm, "unsupported algorithm: %s", algorithm)
+	return nil
+}
+
+func newHashObject(vm *goja.Runtime, h hash.Hash) *goja.Object {
+	o := vm.NewObject()
+	var digested bool
+	o.Set("update", func(data string) *goja.Object {
+		if digested {
+			throwError(vm, "Digest already called")
+		}
+		h.Write([]byte(data))
+		return o
+	})
+	o.Set("digest", func(call goja.FunctionCall) goja.Value {
+		if digested {
+			throwError(vm, "Digest already called")
+		}
+		digested = true
+		sum := h.Sum(nil)
+		var encoding string
+		if a := call.Argument(0); !goja.IsUndefined(a) {
+			encoding = a.String()
+		}
+		switch encoding {
+		case "hex":
+			return vm.ToValue(hex.EncodeToString(sum))
+		case "base64":
+			return vm.ToValue(base64.StdEncoding.EncodeToString(sum))
+		case "base64url":
+			return vm.ToValue(base64.RawURLEncoding.EncodeToString(sum))
+		case "":
+			return vm.ToValue(byteString(sum))
+		}
+		throwError(vm, "unsupported encoding: %s", encoding)
+		return nil
+	})
+	return o
+}
+
+// byteString converts bytes to a string which has a character per byte.
+func byteString(b []byte) string {
+	rs := make([]rune, len(b))
+	for i, c := range b {
+		rs[i] = rune(c)
+	}
+	return string(rs)
+}
+
+func newQueryStringModule(vm *goja.Runtime) *goja.Object {
+	m := vm.NewObject()
+	parse := func(call goja.FunctionCall) goja.Value {
+		return queryStringParse(vm, call)
+	}
+	stringify := func(call goja.FunctionCall) goja.Value {
+		return queryStringStringify(vm, call)
+	}
+	m.Set("parse", parse)
+	m.Set("decode", parse)
+	m.Set("stringify", stringify)
+	m.Set("encode", stringify)
+	m.Set("escape", queryStringEscape)
+	m.Set("unescape", queryStringUnescape)
+	return m
+}
+
+// queryStringArgs returns separator, equal and options of querystring.parse and querystring.stringify.
+func queryStringArgs(vm *goja.Runtime, call goja.FunctionCall) (string, string, *goja.Object) {
+	sep, eq := "&", "="
+	if a := call.Argument(1); !goja.IsUndefined(a) && !goja.IsNull(a) && a.String() != "" {
+		sep = a.String()
+	}
+	if a := call.Argument(2); !goja.IsUndefined(a) && !goja.IsNull(a) && a.String() != "" {
+		eq = a.String()
+	}
+	var options *goja.Object
+	if a := call.Argument(3); !goja.IsUndefined(a) && !goja.IsNull(a) {
+		options = a.ToObject(vm)
+	}
+	return sep, eq, options
+}
+
+// queryStringCodec returns a function specified in options, or the default function.
+func queryStringCodec(vm *goja.Runtime, options *goja.Object, name string, defaultFunc func(string) string) func(string) string {
+	if options == nil {
+		return defaultFunc
+	}
+	fn, ok := goja.AssertFunction(options.Get(name))
+	if !ok {
+		return defaultFunc
+	}
+	return func(s string) string {
+		v, err := fn(goja.Undefined(), vm.ToValue(s))
+		if err != nil {
+			panic(err)
+		}
+		return v.String()
+	}
+}
+
+func queryStringParse(vm *goja.Runtime, call goja.FunctionCall) goja.Value {
+	// the result has no prototype as Node.js, not to merge with inherited properties like toString
+	obj := vm.NewObject()
+	obj.SetPrototype(nil)
+	str, ok := call.Argument(0).Export().(string)
+	if !ok || str == "" {
+		return obj
+	}
+	sep, eq, options := queryStringArgs(vm, call)
+	decode := queryStringCodec(vm, options, "decodeURIComponent", queryStringUnescape)
+	maxKeys := int64(1000)
+	if options != nil {
+		if v := options.Get("maxKeys"); v != nil && !goja.IsUndefined(v) {
+			maxKeys = v.ToInteger()
+		}
+	}
+
+	var keys int64
+	for _, pair := range strings.Split(str, sep) {
+		if pair == "" {
+			continue
+		}
+		if maxKeys > 0 && keys >= maxKeys {
+			break
+		}
+		keys++
+		k, v, _ := strings.Cut(pair, eq)
+		k = decode(strings.ReplaceAll(k, "+", " "))
+		v = decode(strings.ReplaceAll(v, "+", " "))
+		cur := obj.Get(k)
+		if cur == nil {
+			obj.Set(k, v)
+		} else if arr, ok := cur.(*goja.Object); ok && arr.ClassName() == "Array" {
+			arr.Set(fmt.Sprint(arr.Get("length").ToInteger()), v)
+		} else {
+			obj.Set(k, vm.NewArray(cur, v))
+		}
+	}
+	return obj
+}
+
+func queryStringStringify(vm *goja.Runtime, call goja.FunctionCall) goja.Value {
+	v := call.Argument(0)
+	if goja.IsUndefined(v) || goja.IsNull(v) {
+		return vm.ToValue("")
+	}
+	obj, ok := v.(*goja.Object)
+	if !ok {
+		return vm.ToValue("")
+	}
+	sep, eq, options := queryStringArgs(vm, call)
+	encode := queryStringCodec(vm, options, "encodeURIComponent", queryStringEscape)
+
+	fields := []string{}
+	for _, k := range obj.Keys() {
+		ks := encode(k) + eq
+		value := obj.Get(k)
+		if o, ok := value.(*goja.Object); ok && o.ClassName() == "Array" {
+			l := o.Get("length").ToInteger()
+			for i := int64(0); i < l; i++ {
+				fields = append(fields, ks+encode(stringifyPrimitive(o.Get(fmt.Sprint(i)))))
+			}
+			continue
+		}
+		fields = append(fields, ks+encode(stringifyPrimitive(value)))
+	}
+	return vm.ToValue(strings.Join(fields, sep))
+}
+
+func stringifyPrimitive(v goja.Value) string {
+	switch x := v.Export().(type) {
+	case string:
+		return x
+	case bool:
+		return fmt.Sprint(x)
+	case int64:
+		return v.String()
+	case float64:
+		if math.IsInf(x, 0) || math.IsNaN(x) {
+			return ""
+		}
+		return v.String()
+	}
+	return ""
+}
+
+// queryStringEscape encodes a string like encodeURIComponent().
+func queryStringEscape(s string) string {
+	const unreserved = "-_.!~*'()"
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte(unreserved, c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// queryStringUnescape decodes percent-encoded sequences. Malformed sequences are kept as is.
+func queryStringUnescape(s string) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			d, _ := hex.DecodeString(s[i+1 : i+3])
+			b = append(b, d[0])
+			i += 2
+			continue
+		}
+		b = append(b, s[i])
+	}
+	return strings.ToValidUTF8(string(b), "�")
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func (r *LocalRunner) newCloudFrontModule(ctx context.Context, vm *goja.Runtime, eventType string, logger *slog.Logger) *goja.Object {
+	m := vm.NewObject()
+	m.Set("kvs", func(call goja.FunctionCall) goja.Value {
+		if r.kvs == nil {
+			throwError(vm, "no KeyValueStore is associated with the function")
+		}
+		if a := call.Argument(0); !goja.IsUndefined(a) && r.kvsID != "" && a.String() != r.kvsID {
+			throwError(vm, "KeyValueStore %s is not associated with the function", a.String())
+		}
+		return r.newKVSHandle(ctx, vm)
+	})
+
+	// origin modification helpers are available only in viewer-request events.
+	// The local runner cannot change the origin, so it only validates the arguments and logs the change.
+	originHelper := func(name string, validate func(goja.Value) bool) func(goja.Value) {
+		return func(v goja.Value) {
+			if eventType != "viewer-request" {
+				throwError(vm, "%s is available only in viewer-request events", name)
+			}
+			if !validate(v) {
+				throwError(vm, "invalid argument for %s", name)
+			}
+			b, _ := valueToJSON(vm, v)
+			logger.Info(f("%s is called", name), "origin", string(b))
+		}
+	}
+	isObject := func(v goja.Value) bool {
+		_, ok := v.(*goja.Object)
+		return ok
+	}
+	m.Set("updateRequestOrigin", originHelper("updateRequestOrigin", isObject))
+	m.Set("selectRequestOriginById", originHelper("selectRequestOriginById", func(v goja.Value) bool {
+		s, ok := v.Export().(string)
+		return ok && s != ""
+	}))
+	m.Set("createRequestOriginGroup", originHelper("createRequestOriginGroup", func(v goja.Value) bool {
+		if !isObject(v) {
+			return false
+		}
+		ids, ok := v.ToObject(vm).Get("originIds").(*goja.Object)
+		return ok && ids.ClassName() == "Array"
+	}))
+	return m
+}
+
+func (r *LocalRunner) newKVSHandle(ctx context.Context, vm *goja.Runtime) *goja.Object {
+	h := vm.NewObject()
+	h.Set("get", func(key string, options goja.Value) *goja.Promise {
+		p, resolve, reject := vm.NewPromise()
+		format := "string"
+		if options != nil && !goja.IsUndefined(options) && !goja.IsNull(options) {
+			if v := options.ToObject(vm).Get("format"); v != nil && !goja.IsUndefined(v) {
+				format = v.String()
+			}
+		}
+		value, err := r.kvs.Get(ctx, key)
+		if err != nil {
+			reject(kvsError(vm, err))
+			return p
+		}
+		switch format {
+		case "string":
+			resolve(value)
+		case "json":
+			v, err := jsonToValue(vm, []byte(value))
+			if err != nil {
+				reject(kvsError(vm, err))
+				return p
+			}
+			resolve(v)
+		case "bytes":
+			u8, err := vm.New(vm.Get("Uint8Array"), vm.ToValue(vm.NewArrayBuffer([]byte(value))))
+			if err != nil {
+				reject(kvsError(vm, err))
+				return p
+			}
+			resolve(u8)
+		default:
+			reject(kvsError(vm, fmt.Errorf("unknown format %s", format)))
+		}
+		return p
+	})
+	h.Set("exists", func(key string) *goja.Promise {
+		p, resolve, reject := vm.NewPromise()
+		_, err := r.kvs.Get(ctx, key)
+		switch {
+		case err == nil:
+			resolve(true)
+		case errors.Is(err, ErrKVSKeyNotFound):
+			resolve(false)
+		default:
+			reject(kvsError(vm, err))
+		}
+		return p
+	})
+	return h
+}
+
+func kvsError(vm *goja.Runtime, err error) goja.Value {
+	e, _ := vm.New(vm.Get("Error"), vm.ToValue(err.Error()))
+	return e
+}
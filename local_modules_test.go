@@ -0,0 +1,265 @@
+package cfft_test
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+	"github.com/fujiwara/cfft"
+)
+
+const moduleTestEvent = `{"version":"1.0","context":{"eventType":"viewer-request"},"viewer":{"ip":"1.2.3.4"},"request":{"method":"GET","uri":"/"}}`
+
+// evalLocal runs the code which defines result() in the local runner and returns the JSON of the result.
+func evalLocal(ctx context.Context, t *testing.T, r *cfft.LocalRunner) (string, error) {
+	t.Helper()
+	out, err := r.Run(ctx, "test", "", []byte(moduleTestEvent), slog.Default())
+	if err != nil {
+		return "", err
+	}
+	var res struct {
+		Response struct {
+			Body string `json:"body"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(out.Output, &res); err != nil {
+		t.Fatal(err)
+	}
+	return res.Response.Body, nil
+}
+
+func newModuleTestRunner(code string) *cfft.LocalRunner {
+	code += `
+async function handler(event) {
+  return { statusCode: 200, body: JSON.stringify(await result()) };
+}`
+	return cfft.NewLocalRunner([]byte(code), types.FunctionRuntimeCloudfrontJs20)
+}
+
+var localModuleTests = []struct {
+	name   string
+	code   string
+	expect string
+	err    string
+}{
+	// crypto
+	{
+		name:   "md5 hex",
+		code:   `import crypto from 'crypto'; function result() { return crypto.createHash('md5').update('').digest('hex'); }`,
+		expect: `"d41d8cd98f00b204e9800998ecf8427e"`,
+	},
+	{
+		name:   "sha1 hex",
+		code:   `const crypto = require('crypto'); function result() { return crypto.createHash('sha1').update('abc').digest('hex'); }`,
+		expect: `"a9993e364706816aba3e25717850c26c9cd0d89d"`,
+	},
+	{
+		name:   "sha256 chained update",
+		code:   `import crypto from 'crypto'; function result() { return crypto.createHash('sha256').update('a').update('bc').digest('hex'); }`,
+		expect: `"ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"`,
+	},
+	{
+		name:   "sha256 base64",
+		code:   `import crypto from 'crypto'; function result() { return crypto.createHash('sha256').update('abc').digest('base64'); }`,
+		expect: `"ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0="`,
+	},
+	{
+		name:   "sha256 base64url",
+		code:   `import crypto from 'crypto'; function result() { return crypto.createHash('sha256').update('abc').digest('base64url'); }`,
+		expect: `"ungWv48Bz-pBQUDeXa4iI7ADYaOWF3qctBD_YfIAFa0"`,
+	},
+	{
+		name:   "md5 byte string",
+		code:   `import crypto from 'crypto'; function result() { return crypto.createHash('md5').update('').digest().length; }`,
+		expect: `16`,
+	},
+	{
+		name:   "hmac md5",
+		code:   `import crypto from 'crypto'; function result() { return crypto.createHmac('md5', 'key').update('The quick brown fox jumps over the lazy dog').digest('hex'); }`,
+		expect: `"80070713463e7749b90c2dc24911e275"`,
+	},
+	{
+		name:   "hmac sha1",
+		code:   `import crypto from 'crypto'; function result() { return crypto.createHmac('sha1', 'key').update('The quick brown fox jumps over the lazy dog').digest('hex'); }`,
+		expect: `"de7c9b85b8b78aa6bc8a7a36f70a90701c9db4d9"`,
+	},
+	{
+		name:   "hmac sha256",
+		code:   `import crypto from 'crypto'; function result() { return crypto.createHmac('sha256', 'key').update('The quick brown fox jumps over the lazy dog').digest('hex'); }`,
+		expect: `"f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"`,
+	},
+	{
+		name: "unsupported algorithm",
+		code: `import crypto from 'crypto'; function result() { return crypto.createHash('sha512'); }`,
+		err:  "unsupported algorithm: sha512",
+	},
+	{
+		name: "digest twice",
+		code: `import crypto from 'crypto'; function result() { const h = crypto.createHash('md5'); h.digest('hex'); return h.digest('hex'); }`,
+		err:  "Digest already called",
+	},
+	// querystring
+	{
+		name:   "parse multi values",
+		code:   `import qs from 'querystring'; function result() { return qs.parse('foo=bar&abc=xyz&abc=123'); }`,
+		expect: `{"foo":"bar","abc":["xyz","123"]}`,
+	},
+	{
+		name:   "parse keys of object prototype",
+		code:   `import qs from 'querystring'; function result() { const q = qs.parse('toString=1&constructor=x&constructor=y&a=2'); return [q, Object.getPrototypeOf(q)]; }`,
+		expect: `[{"toString":"1","constructor":["x","y"],"a":"2"},null]`,
+	},
+	{
+		name:   "parse plus and percent",
+		code:   `import qs from 'querystring'; function result() { return qs.parse('a+b=c+d&e=%E3%81%82&f=%ZZ'); }`,
+		expect: `{"a b":"c d","e":"あ","f":"%ZZ"}`,
+	},
+	{
+		name:   "parse empty values",
+		code:   `import qs from 'querystring'; function result() { return qs.parse('a&b=&&c=1'); }`,
+		expect: `{"a":"","b":"","c":"1"}`,
+	},
+	{
+		name:   "parse separator and equal",
+		code:   `import qs from 'querystring'; function result() { return qs.parse('a:1;b:2', ';', ':'); }`,
+		expect: `{"a":"1","b":"2"}`,
+	},
+	{
+		name:   "parse maxKeys",
+		code:   `import qs from 'querystring'; function result() { return qs.parse('a=1&b=2&c=3', null, null, { maxKeys: 2 }); }`,
+		expect: `{"a":"1","b":"2"}`,
+	},
+	{
+		name:   "parse custom decoder",
+		code:   `import qs from 'querystring'; function result() { return qs.decode('a=x', null, null, { decodeURIComponent: (s) => s.toUpperCase() }); }`,
+		expect: `{"A":"X"}`,
+	},
+	{
+		name:   "stringify",
+		code:   `import qs from 'querystring'; function result() { return qs.stringify({ foo: 'bar', baz: ['qux', 'quux'], corge: '' }); }`,
+		expect: `"foo=bar&baz=qux&baz=quux&corge="`,
+	},
+	{
+		name:   "stringify separator and equal",
+		code:   `import qs from 'querystring'; function result() { return qs.encode({ foo: 'bar', baz: 'qux' }, ';', ':'); }`,
+		expect: `"foo:bar;baz:qux"`,
+	},
+	{
+		name:   "stringify primitives",
+		code:   `import qs from 'querystring'; function result() { return qs.stringify({ a: 1, b: true, c: null, d: NaN, e: {}, 'f g': 'h!*' }); }`,
+		expect: `"a=1&b=true&c=&d=&e=&f%20g=h!*"`,
+	},
+	{
+		name:   "escape and unescape",
+		code:   `import qs from 'querystring'; function result() { return [qs.escape('a b&c/é'), qs.unescape('a%20b%2Fc')]; }`,
+		expect: `["a%20b%26c%2F%C3%A9","a b/c"]`,
+	},
+	// cloudfront
+	{
+		name:   "kvs get",
+		code:   `import cf from 'cloudfront'; const kvs = cf.kvs('kvs-id'); async function result() { return [await kvs.get('foo'), await kvs.get('json', { format: 'json' })]; }`,
+		expect: `["bar",{"x":1}]`,
+	},
+	{
+		name:   "kvs get bytes",
+		code:   `import cf from 'cloudfront'; async function result() { const b = await cf.kvs().get('foo', { format: 'bytes' }); return [b.length, b[0]]; }`,
+		expect: `[3,98]`,
+	},
+	{
+		name:   "kvs exists",
+		code:   `import cf from 'cloudfront'; async function result() { return [await cf.kvs().exists('foo'), await cf.kvs().exists('nope')]; }`,
+		expect: `[true,false]`,
+	},
+	{
+		name: "kvs get not found",
+		code: `import cf from 'cloudfront'; async function result() { return await cf.kvs().get('nope'); }`,
+		err:  "KVS key does not exist",
+	},
+	{
+		name:   "kvs get not found caught",
+		code:   `import cf from 'cloudfront'; async function result() { try { return await cf.kvs().get('nope'); } catch (e) { return 'default'; } }`,
+		expect: `"default"`,
+	},
+	{
+		name: "kvs other id",
+		code: `import cf from 'cloudfront'; const kvs = cf.kvs('other-id'); function result() {}`,
+		err:  "KeyValueStore other-id is not associated",
+	},
+	{
+		name:   "select origin",
+		code:   `import cf from 'cloudfront'; function result() { cf.selectRequestOriginById('origin-1'); cf.updateRequestOrigin({ domainName: 'example.com' }); cf.createRequestOriginGroup({ originIds: ['a', 'b'] }); return 'ok'; }`,
+		expect: `"ok"`,
+	},
+	{
+		name: "invalid origin group",
+		code: `import cf from 'cloudfront'; function result() { cf.createRequestOriginGroup({}); }`,
+		err:  "invalid argument for createRequestOriginGroup",
+	},
+	{
+		name: "unknown module",
+		code: `const fs = require('fs'); function result() {}`,
+		err:  "Cannot find module 'fs'",
+	},
+	// globals
+	{
+		name:   "btoa",
+		code:   `function result() { return [btoa('hello'), btoa(''), btoa('\u00e9')]; }`,
+		expect: `["aGVsbG8=","","6Q=="]`,
+	},
+	{
+		name:   "atob",
+		code:   `function result() { return [atob('aGVsbG8='), atob('aGVs bG8'), atob('6Q==') === '\u00e9', atob(btoa('\u00ff\u0000')) === '\u00ff\u0000']; }`,
+		expect: `["hello","hello",true,true]`,
+	},
+	{
+		name: "btoa non-latin1",
+		code: `function result() { return btoa('\u3042'); }`,
+		err:  "btoa() accepts only Latin1 characters",
+	},
+	{
+		name: "atob invalid",
+		code: `function result() { return atob('a'); }`,
+		err:  "atob() accepts only base64 encoded string",
+	},
+}
+
+func TestLocalModules(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	kvs := cfft.MapKVS{"foo": "bar", "json": `{"x":1}`}
+	for _, tt := range localModuleTests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newModuleTestRunner(tt.code)
+			r.SetKVS("kvs-id", kvs)
+			out, err := evalLocal(ctx, t, r)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != tt.expect {
+				t.Errorf("unexpected result: %s, expected %s", out, tt.expect)
+			}
+		})
+	}
+}
+
+func TestLocalModulesRuntime10(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	code := `var crypto = require('crypto');
+function handler(event) {
+  var cf = require('cloudfront');
+  return event.request;
+}`
+	r := cfft.NewLocalRunner([]byte(code), types.FunctionRuntimeCloudfrontJs10)
+	_, err := r.Run(ctx, "test", "", []byte(moduleTestEvent), slog.Default())
+	if err == nil || !strings.Contains(err.Error(), "Cannot find module 'cloudfront'") {
+		t.Errorf("cloudfront module must not be available in %s: %v", types.FunctionRuntimeCloudfrontJs10, err)
+	}
+}
@@ -0,0 +1,205 @@
+package cfft
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/parser"
+	"github.com/dop251/goja/token"
+)
+
+// supportedModules are the modules which can be imported or required in each runtime.
+var supportedModules = map[types.FunctionRuntime][]string{
+	types.FunctionRuntimeCloudfrontJs10: {"crypto", "querystring"},
+	types.FunctionRuntimeCloudfrontJs20: {"cloudfront", "crypto", "querystring"},
+}
+
+// unsupportedFunctions are the global functions which are not available in both runtimes.
+var unsupportedFunctions = map[string]string{
+	"eval":           "dynamic code evaluation (eval)",
+	"Function":       "dynamic code evaluation (Function constructor)",
+	"setTimeout":     "timers (setTimeout)",
+	"setInterval":    "timers (setInterval)",
+	"setImmediate":   "timers (setImmediate)",
+	"clearTimeout":   "timers (clearTimeout)",
+	"clearInterval":  "timers (clearInterval)",
+	"clearImmediate": "timers (clearImmediate)",
+}
+
+// RuntimeRestrictionError is returned when the function code uses features which are not supported in the runtime.
+type RuntimeRestrictionError struct {
+	Runtime    types.FunctionRuntime
+	Violations []string
+}
+
+func (e *RuntimeRestrictionError) Error() string {
+	return fmt.Sprintf("the function code uses features not supported in runtime %s: %s", e.Runtime, strings.Join(e.Violations, ", "))
+}
+
+// checkRuntimeRestrictions checks that the code uses only the features supported in the runtime.
+func checkRuntimeRestrictions(name, code string, runtime types.FunctionRuntime) error {
+	rerr := &RuntimeRestrictionError{Runtime: runtime}
+	for i, line := range strings.Split(code, "\n") {
+		m := importRegexp.FindStringSubmatchIndex(line)
+		if m == nil {
+			continue
+		}
+		module := line[m[4]:m[5]]
+		switch {
+		case runtime == types.FunctionRuntimeCloudfrontJs10:
+			rerr.add(name, i+1, m[0]+1, "import statement (use require())")
+		case !isSupportedModule(runtime, module):
+			rerr.add(name, i+1, m[0]+1, f("import of module '%s'", module))
+		}
+	}
+
+	prog, err := parser.ParseFile(nil, name, rewriteImports(code), 0)
+	if err != nil {
+		return fmt.Errorf("failed to parse function code, %w", err)
+	}
+	c := &restrictionChecker{
+		runtime: runtime,
+		prog:    prog,
+		err:     rerr,
+	}
+	walkAST(prog.Body, c.check)
+	if len(rerr.Violations) > 0 {
+		return rerr
+	}
+	return nil
+}
+
+func isSupportedModule(runtime types.FunctionRuntime, module string) bool {
+	for _, m := range supportedModules[runtime] {
+		if m == module {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *RuntimeRestrictionError) add(name string, line, column int, feature string) {
+	e.Violations = append(e.Violations, f("%s at %s:%d:%d", feature, name, line, column))
+}
+
+type restrictionChecker struct {
+	runtime types.FunctionRuntime
+	prog    *ast.Program
+	err     *RuntimeRestrictionError
+}
+
+// visitKey identifies a node. A node embedded as the first field shares the address with its parent.
+type visitKey struct {
+	t reflect.Type
+	p uintptr
+}
+
+// walkAST calls fn for all nodes in the AST in depth-first order, by reflection.
+func walkAST(node any, fn func(ast.Node)) {
+	walkValue(reflect.ValueOf(node), map[visitKey]bool{}, fn)
+}
+
+func walkValue(v reflect.Value, visited map[visitKey]bool, fn func(ast.Node)) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		key := visitKey{t: v.Type(), p: v.Pointer()}
+		if v.IsNil() || visited[key] {
+			return
+		}
+		visited[key] = true
+		if n, ok := v.Interface().(ast.Node); ok {
+			fn(n)
+		}
+		walkValue(v.Elem(), visited, fn)
+	case reflect.Interface:
+		if !v.IsNil() {
+			walkValue(v.Elem(), visited, fn)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			walkValue(v.Index(i), visited, fn)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			// some nodes are embedded by value (e.g. LexicalDeclaration in ForLoopInitializerLexicalDecl)
+			if fv := v.Field(i); fv.Kind() == reflect.Struct && fv.CanAddr() {
+				walkValue(fv.Addr(), visited, fn)
+			} else {
+				walkValue(fv, visited, fn)
+			}
+		}
+	}
+}
+
+func (c *restrictionChecker) report(n ast.Node, feature string) {
+	p := c.prog.File.Position(int(n.Idx0()) - c.prog.File.Base())
+	c.err.add(p.Filename, p.Line, p.Column, feature)
+}
+
+func (c *restrictionChecker) check(n ast.Node) {
+	// restrictions in both runtimes
+	switch n := n.(type) {
+	case *ast.CallExpression:
+		c.checkCallee(n, n.Callee)
+	case *ast.NewExpression:
+		c.checkCallee(n, n.Callee)
+	}
+	if c.runtime != types.FunctionRuntimeCloudfrontJs10 {
+		return
+	}
+
+	// cloudfront-js-1.0 is compliant with ES 5.1 and supports some ES 6+ features.
+	switch n := n.(type) {
+	case *ast.LexicalDeclaration:
+		c.report(n, f("%s declaration", n.Token))
+	case *ast.ForDeclaration:
+		if n.IsConst {
+			c.report(n, "const declaration")
+		} else {
+			c.report(n, "let declaration")
+		}
+	case *ast.FunctionLiteral:
+		if n.Async {
+			c.report(n, "async function")
+		}
+		if n.Generator {
+			c.report(n, "generator function")
+		}
+	case *ast.ArrowFunctionLiteral:
+		if n.Async {
+			c.report(n, "async function")
+		}
+	case *ast.AwaitExpression:
+		c.report(n, "await expression")
+	case *ast.ClassLiteral:
+		c.report(n, "class")
+	case *ast.ForOfStatement:
+		c.report(n, "for-of statement")
+	case *ast.ObjectPattern, *ast.ArrayPattern:
+		c.report(n, "destructuring assignment")
+	case *ast.SpreadElement:
+		c.report(n, "spread syntax")
+	case *ast.OptionalChain:
+		c.report(n, "optional chaining")
+	case *ast.BinaryExpression:
+		if n.Operator == token.COALESCE {
+			c.report(n, "nullish coalescing operator")
+		}
+	}
+}
+
+func (c *restrictionChecker) checkCallee(n ast.Node, callee ast.Expression) {
+	id, ok := callee.(*ast.Identifier)
+	if !ok {
+		return
+	}
+	if feature, ok := unsupportedFunctions[id.Name.String()]; ok {
+		c.report(n, feature)
+	}
+}
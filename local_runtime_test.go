@@ -0,0 +1,68 @@
+package cfft_test
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+	"github.com/fujiwara/cfft"
+)
+
+var runtimeRestrictionTests = []struct {
+	runtime types.FunctionRuntime
+	code    string
+	err     string
+}{
+	{runtime: types.FunctionRuntimeCloudfrontJs10, code: "var x = 1;\nconst y = 2;", err: "const declaration at test:2:1"},
+	{runtime: types.FunctionRuntimeCloudfrontJs10, code: "let y = 2;", err: "let declaration at test:1:1"},
+	{runtime: types.FunctionRuntimeCloudfrontJs10, code: "for (let i = 0; i < 1; i++) {}", err: "let declaration at test:1:6"},
+	{runtime: types.FunctionRuntimeCloudfrontJs10, code: "for (const x of []) {}", err: "for-of statement at test:1:1"},
+	{runtime: types.FunctionRuntimeCloudfrontJs10, code: "async function f() {}", err: "async function at test:1:1"},
+	{runtime: types.FunctionRuntimeCloudfrontJs10, code: "var f = async () => 1;", err: "async function at test:1:9"},
+	{runtime: types.FunctionRuntimeCloudfrontJs10, code: "function* g() { yield 1; }", err: "generator function"},
+	{runtime: types.FunctionRuntimeCloudfrontJs10, code: "class A {}", err: "class at test:1:1"},
+	{runtime: types.FunctionRuntimeCloudfrontJs10, code: "var { a } = {};", err: "destructuring assignment at test:1:5"},
+	{runtime: types.FunctionRuntimeCloudfrontJs10, code: "var a = [...[1]];", err: "spread syntax"},
+	{runtime: types.FunctionRuntimeCloudfrontJs10, code: "var a = {}; var b = a?.b;", err: "optional chaining"},
+	{runtime: types.FunctionRuntimeCloudfrontJs10, code: "var a = null ?? 1;", err: "nullish coalescing operator"},
+	{runtime: types.FunctionRuntimeCloudfrontJs10, code: "import crypto from 'crypto';", err: "import statement (use require()) at test:1:1"},
+	{runtime: types.FunctionRuntimeCloudfrontJs10, code: "var crypto = require('crypto'); var f = (x) => `${x ** 2}`;"},
+	{runtime: types.FunctionRuntimeCloudfrontJs20, code: "const a = 1; let b = async () => { for (const x of [...[a]]) { await x; } };"},
+	{runtime: types.FunctionRuntimeCloudfrontJs20, code: "import cf from 'cloudfront';\nimport crypto from 'crypto';"},
+	{runtime: types.FunctionRuntimeCloudfrontJs20, code: "import fs from 'fs';", err: "import of module 'fs' at test:1:1"},
+	{runtime: types.FunctionRuntimeCloudfrontJs20, code: "var x = 1;\n  eval('x');", err: "dynamic code evaluation (eval) at test:2:3"},
+	{runtime: types.FunctionRuntimeCloudfrontJs20, code: "var f = new Function('return 1');", err: "dynamic code evaluation (Function constructor)"},
+	{runtime: types.FunctionRuntimeCloudfrontJs20, code: "setTimeout(() => {}, 1);", err: "timers (setTimeout)"},
+}
+
+func TestRuntimeRestrictions(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	event := []byte(`{"context":{"eventType":"viewer-request"},"request":{"method":"GET","uri":"/"}}`)
+	for _, tt := range runtimeRestrictionTests {
+		t.Run(string(tt.runtime)+" "+tt.code, func(t *testing.T) {
+			code := tt.code + "\nfunction handler(event) { return event.request; }"
+			r := cfft.NewLocalRunner([]byte(code), tt.runtime)
+			_, err := r.Run(ctx, "test", "", event, slog.Default())
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestRuntime10NoPromise(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	event := []byte(`{"context":{"eventType":"viewer-request"},"request":{"method":"GET","uri":"/"}}`)
+	code := `function handler(event) { return Promise.resolve(event.request); }`
+	r := cfft.NewLocalRunner([]byte(code), types.FunctionRuntimeCloudfrontJs10)
+	if _, err := r.Run(ctx, "test", "", event, slog.Default()); err == nil || !strings.Contains(err.Error(), "Promise is not defined") {
+		t.Errorf("Promise must not be available in %s: %v", types.FunctionRuntimeCloudfrontJs10, err)
+	}
+}
@@ -0,0 +1,420 @@
+package cfft_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+	"github.com/dop251/goja"
+	"github.com/fujiwara/cfft"
+)
+
+func TestLocalRunnerRun(t *testing.T) {
+	configs := []string{
+		"testdata/funcv1/cfft.yaml",
+		"testdata/funcv2/cfft.yaml",
+		"testdata/partial-event/cfft.yaml",
+		"examples/add-cache-control/cfft.yaml",
+	}
+	ctx := cfft.NewTestContext()
+	for _, config := range configs {
+		t.Run(filepath.Base(filepath.Dir(config)), func(t *testing.T) {
+			conf, err := cfft.LoadConfig(ctx, config)
+			if err != nil {
+				t.Fatalf("failed to load config: %v", err)
+			}
+			app, err := cfft.New(ctx, conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, err := conf.FunctionCode(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			app.SetRunner(cfft.NewLocalRunner(code, conf.Runtime))
+			for _, cs := range conf.TestCases {
+				if err := app.RunTestCase(ctx, "", cs); err != nil {
+					t.Errorf("failed to test: %v", err)
+				}
+			}
+		})
+	}
+}
+
+var localRunnerOutputTests = []struct {
+	name   string
+	code   string
+	event  string
+	output string
+	err    string
+}{
+	{
+		name:   "request",
+		code:   `function handler(event) { event.request.uri = '/foo'; return event.request; }`,
+		event:  `{"context":{"eventType":"viewer-request"},"request":{"method":"GET","uri":"/"}}`,
+		output: `{"request":{"method":"GET","uri":"/foo"}}`,
+	},
+	{
+		name:   "response from viewer-request",
+		code:   `async function handler(event) { return { statusCode: 302, headers: { location: { value: '/' } } }; }`,
+		event:  `{"context":{"eventType":"viewer-request"},"request":{"method":"GET","uri":"/"}}`,
+		output: `{"response":{"statusCode":302,"headers":{"location":{"value":"/"}}}}`,
+	},
+	{
+		name:   "const handler",
+		code:   `const handler = async (event) => event.response;`,
+		event:  `{"context":{"eventType":"viewer-response"},"response":{"statusCode":200}}`,
+		output: `{"response":{"statusCode":200}}`,
+	},
+	{
+		name:  "throw",
+		code:  `function handler(event) { throw new Error('oops'); }`,
+		event: `{"context":{"eventType":"viewer-request"},"request":{}}`,
+		err:   "Error: oops",
+	},
+	{
+		name:  "rejected",
+		code:  `async function handler(event) { null.foo; }`,
+		event: `{"context":{"eventType":"viewer-request"},"request":{}}`,
+		err:   "TypeError",
+	},
+	{
+		name:  "no handler",
+		code:  `function main(event) { return event.request; }`,
+		event: `{"context":{"eventType":"viewer-request"},"request":{}}`,
+		err:   "handler is not defined",
+	},
+}
+
+func TestLocalRunnerOutput(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	for _, tt := range localRunnerOutputTests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := cfft.NewLocalRunner([]byte(tt.code), types.FunctionRuntimeCloudfrontJs20)
+			out, err := r.Run(ctx, tt.name, "", []byte(tt.event), slog.Default())
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out.Output) != tt.output {
+				t.Errorf("unexpected output: %s", out.Output)
+			}
+		})
+	}
+}
+
+func TestLocalRunnerTimeout(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	event := []byte(`{"context":{"eventType":"viewer-request"},"request":{"method":"GET","uri":"/"}}`)
+	r := cfft.NewLocalRunner([]byte(`function handler(event) { while (true) {} }`), types.FunctionRuntimeCloudfrontJs20)
+	r.SetTimeout(100 * time.Millisecond)
+	_, err := r.Run(ctx, "infinite", "", event, slog.Default())
+	var ferr *cfft.FunctionError
+	if !errors.As(err, &ferr) || !strings.Contains(ferr.Message, "exceeded the maximum allowed execution time") {
+		t.Errorf("expected function error by timeout, got %v", err)
+	}
+}
+
+func TestLocalRunnerComputeUtilization(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	event := []byte(`{"context":{"eventType":"viewer-request"},"request":{"method":"GET","uri":"/"}}`)
+	for _, tt := range []struct {
+		name string
+		code string
+		cu   int
+	}{
+		{name: "light", code: `function handler(event) { return event.request; }`, cu: 1},
+		// 1 call of handler and 29999 iterations are 30000 steps, which is 1.5 times the steps regarded as 100
+		{name: "heavy", code: `function handler(event) { let s = 0; for (let i = 0; i < 29999; i++) { s += i; } return event.request; }`, cu: 150},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := cfft.NewLocalRunner([]byte(tt.code), types.FunctionRuntimeCloudfrontJs20)
+			// the estimate is deterministic
+			for i := 0; i < 2; i++ {
+				res, err := r.Run(ctx, tt.name, "", event, slog.Default())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if res.ComputeUtilization != tt.cu {
+					t.Errorf("unexpected ComputeUtilization: %d, expected %d", res.ComputeUtilization, tt.cu)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalRunnerMaxComputeUtilization(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	conf, err := cfft.LoadConfig(ctx, "testdata/funcv2/cfft.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := cfft.New(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := `function handler(event) { let s = 0; for (let i = 0; i < 29999; i++) { s += i; } return event.request; }`
+	app.SetRunner(cfft.NewLocalRunner([]byte(code), conf.Runtime))
+	cs := conf.TestCases[0]
+	cs.MaxComputeUtilization = 100
+	err = app.RunTestCase(ctx, "", cs)
+	if err == nil || !strings.Contains(err.Error(), "ComputeUtilization 150 exceeds maxComputeUtilization 100") {
+		t.Errorf("maxComputeUtilization must be checked by the local runner, got %v", err)
+	}
+}
+
+// slowKVS simulates the latency of the CloudFront KeyValueStore API.
+type slowKVS struct {
+	cfft.MapKVS
+	delay time.Duration
+}
+
+func (kvs slowKVS) Get(ctx context.Context, key string) (string, error) {
+	time.Sleep(kvs.delay)
+	return kvs.MapKVS.Get(ctx, key)
+}
+
+func TestLocalRunnerComputeUtilizationExcludesKVS(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	event := []byte(`{"context":{"eventType":"viewer-request"},"request":{"method":"GET","uri":"/"}}`)
+	code := `import cf from 'cloudfront';
+const kvs = cf.kvs();
+async function handler(event) {
+  for (let i = 0; i < 5; i++) {
+    if (await kvs.exists('key')) {
+      event.request.uri = await kvs.get('key');
+    }
+  }
+  return event.request;
+}`
+	r := cfft.NewLocalRunner([]byte(code), types.FunctionRuntimeCloudfrontJs20)
+	r.SetKVS("", slowKVS{MapKVS: cfft.MapKVS{"key": "/foo"}, delay: 5 * time.Millisecond})
+	res, err := r.Run(ctx, "kvs", "", event, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ComputeUtilization != 1 {
+		t.Errorf("ComputeUtilization must not include the time of KVS access: %d", res.ComputeUtilization)
+	}
+}
+
+var instrumentStepsTests = []struct {
+	name  string
+	code  string
+	steps int
+}{
+	{name: "function", code: `function f() { return 1; } f(); f();`, steps: 2},
+	{name: "use strict", code: `function f() { "use strict"; return this === undefined; } if (!f()) throw new Error("not strict");`, steps: 1},
+	{name: "arrow", code: `const f = (x) => x + 1; const g = (x) => { return x; }; const h = () => ({ a: 1 }); f(1); g(1); if (h().a !== 1) throw new Error("object");`, steps: 3},
+	{name: "nested arrow", code: `const f = x => y => x + y; if (f(1)(2) !== 3) throw new Error("nested");`, steps: 2},
+	{name: "loops", code: `let s = 0; for (let i = 0; i < 3; i++) { s++; } while (s < 5) s++; do s++; while (s < 7); for (const k in {a: 1}) s++; for (const v of [1, 2]) s++;`, steps: 3 + 2 + 2 + 1 + 2},
+	{name: "loop in if-else", code: `let s = 0; if (true) for (let i = 0; i < 2; i++) s++; else s = 10; if (s !== 2) throw new Error("else");`, steps: 2},
+	{name: "no semicolon", code: "let s = 0\nfor (let i = 0; i < 2; i++) s++\ns++", steps: 2},
+}
+
+func TestInstrumentSteps(t *testing.T) {
+	for _, tt := range instrumentStepsTests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := cfft.InstrumentSteps(tt.name, tt.code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Count(code, "\n") != strings.Count(tt.code, "\n") {
+				t.Errorf("line numbers must be kept: %s", code)
+			}
+			vm := goja.New()
+			vm.Set("__cfftSteps", 0)
+			if _, err := vm.RunString(code); err != nil {
+				t.Fatalf("failed to run %s: %v", code, err)
+			}
+			if steps := vm.Get("__cfftSteps").ToInteger(); steps != int64(tt.steps) {
+				t.Errorf("unexpected steps: %d, expected %d in %s", steps, tt.steps, code)
+			}
+		})
+	}
+}
+
+func TestLocalRunnerWithLocalKVS(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	// testdata/true-client-ip has kvs fixtures in the test cases
+	for _, config := range []string{"examples/true-client-ip/cfft.yaml", "testdata/true-client-ip/cfft.yaml"} {
+		conf, err := cfft.LoadConfig(ctx, config)
+		if err != nil {
+			t.Fatalf("failed to load config: %v", err)
+		}
+		app, err := cfft.New(ctx, conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cli := &cfft.CLI{Test: &cfft.TestCmd{Runner: cfft.RunnerLocal}}
+		if err := app.Dispatch(ctx, []string{"test"}, cli); err != nil {
+			t.Errorf("failed to test %s with local kvs: %v", config, err)
+		}
+		if _, ok := os.LookupEnv("KVS_ID"); ok {
+			t.Error("KVS_ID must be restored after the test")
+		}
+	}
+}
+
+var parseLocalKVSTests = []struct {
+	name   string
+	src    string
+	expect cfft.MapKVS
+}{
+	{
+		name:   "object",
+		src:    `{"foo":"bar","num":1,"obj":{"a":[1,2]}}`,
+		expect: cfft.MapKVS{"foo": "bar", "num": "1", "obj": `{"a":[1,2]}`},
+	},
+	{
+		name:   "array of items",
+		src:    `[{"key":"foo","value":"bar"},{"key":"baz","value":"{\"x\":1}"}]`,
+		expect: cfft.MapKVS{"foo": "bar", "baz": `{"x":1}`},
+	},
+}
+
+func TestParseLocalKVS(t *testing.T) {
+	for _, tt := range parseLocalKVSTests {
+		t.Run(tt.name, func(t *testing.T) {
+			kvs, err := cfft.ParseLocalKVS([]byte(tt.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) != len(tt.expect) {
+				t.Errorf("unexpected kvs: %v", kvs)
+			}
+			for k, v := range tt.expect {
+				if kvs[k] != v {
+					t.Errorf("unexpected value of %s: %q, expected %q", k, kvs[k], v)
+				}
+			}
+		})
+	}
+	if cfft.LocalKVSID("ipset") != cfft.LocalKVSID("ipset") || cfft.LocalKVSID("ipset") == cfft.LocalKVSID("other") {
+		t.Error("local kvs id must be stable for the name")
+	}
+}
+
+func TestParallel(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	for _, config := range []string{"examples/add-cache-control/cfft.yaml", "testdata/true-client-ip/cfft.yaml"} {
+		buf.Reset()
+		conf, err := cfft.LoadConfig(ctx, config)
+		if err != nil {
+			t.Fatalf("failed to load config: %v", err)
+		}
+		app, err := cfft.New(ctx, conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cli := &cfft.CLI{Test: &cfft.TestCmd{Runner: cfft.RunnerLocal, Parallel: 4}}
+		if err := app.Dispatch(ctx, []string{"test"}, cli); err != nil {
+			t.Errorf("failed to test %s in parallel: %v", config, err)
+		}
+
+		// logs must be grouped by test case in order
+		var order []string
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			var l struct {
+				TestCase string `json:"testcase"`
+			}
+			if err := dec.Decode(&l); err != nil {
+				t.Fatal(err)
+			}
+			if l.TestCase != "" && (len(order) == 0 || order[len(order)-1] != l.TestCase) {
+				order = append(order, l.TestCase)
+			}
+		}
+		var expected []string
+		for _, cs := range conf.TestCases {
+			expected = append(expected, cs.Identifier())
+		}
+		if strings.Join(order, ",") != strings.Join(expected, ",") {
+			t.Errorf("logs are not grouped by test case: %v, expected %v", order, expected)
+		}
+	}
+}
+
+var expectErrorTests = []struct {
+	name        string
+	code        string
+	expectError string
+	err         string
+}{
+	{
+		name:        "substring",
+		code:        `function handler(event) { throw new Error('invalid uri: ' + event.request.uri); }`,
+		expectError: "invalid uri",
+	},
+	{
+		name:        "regexp",
+		code:        `async function handler(event) { throw new TypeError('invalid method'); }`,
+		expectError: "/^TypeError: invalid (method|uri)$/",
+	},
+	{
+		name:        "not matched",
+		code:        `function handler(event) { throw new Error('oops'); }`,
+		expectError: "invalid uri",
+		err:         `function error "Error: oops" does not match invalid uri`,
+	},
+	{
+		name:        "no error",
+		code:        `function handler(event) { return event.request; }`,
+		expectError: "invalid uri",
+		err:         "function succeeded, but an error matching invalid uri is expected",
+	},
+}
+
+func TestExpectError(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	conf, err := cfft.LoadConfig(ctx, "testdata/funcv2/cfft.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := cfft.New(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range expectErrorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := &cfft.TestCase{
+				Name:        tt.name,
+				Event:       "testdata/event.json",
+				ExpectError: tt.expectError,
+			}
+			if err := cs.Setup(ctx, cfft.ReadFile); err != nil {
+				t.Fatal(err)
+			}
+			app.SetRunner(cfft.NewLocalRunner([]byte(tt.code), types.FunctionRuntimeCloudfrontJs20))
+			err := app.RunTestCase(ctx, "", cs)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
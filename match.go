@@ -0,0 +1,95 @@
+package cfft
+
+import "fmt"
+
+const (
+	MatchExact  = "exact"
+	MatchSubset = "subset"
+)
+
+func validateMatch(match string) error {
+	switch match {
+	case "", MatchExact, MatchSubset:
+		return nil
+	default:
+		return fmt.Errorf("invalid match %s, must be %s or %s", match, MatchExact, MatchSubset)
+	}
+}
+
+// subsetExpect returns the expected object in the subset mode, which has only the keys written in the expect file.
+// raw is the expect file as is, and parsed is the expect object parsed as CFFExpect.
+// The request and response in HTTP text format are taken from parsed, without the empty values.
+func subsetExpect(raw, parsed map[string]any) map[string]any {
+	m := make(map[string]any, len(raw))
+	for k, v := range raw {
+		if _, ok := v.(string); ok {
+			m[k] = pruneEmpty(parsed[k])
+		} else {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+// pruneEmpty removes empty strings and empty objects from v recursively.
+func pruneEmpty(v any) any {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return v
+	}
+	pruned := make(map[string]any, len(m))
+	for k, v := range m {
+		v = pruneEmpty(v)
+		switch vv := v.(type) {
+		case string:
+			if vv == "" {
+				continue
+			}
+		case map[string]any:
+			if len(vv) == 0 {
+				continue
+			}
+		case nil:
+			continue
+		}
+		pruned[k] = v
+	}
+	return pruned
+}
+
+// projectSubset returns actual which has only the keys in expect recursively.
+// The keys in expect which are missing in actual are also missing in the result, so they are reported by the diff.
+func projectSubset(expect, actual any) any {
+	switch e := expect.(type) {
+	case *matcher:
+		return actual
+	case map[string]any:
+		a, ok := actual.(map[string]any)
+		if !ok {
+			return actual
+		}
+		projected := make(map[string]any, len(e))
+		for k, ev := range e {
+			if av, ok := a[k]; ok {
+				projected[k] = projectSubset(ev, av)
+			}
+		}
+		return projected
+	case []any:
+		a, ok := actual.([]any)
+		if !ok {
+			return actual
+		}
+		projected := make([]any, len(a))
+		for i, av := range a {
+			if i < len(e) {
+				projected[i] = projectSubset(e[i], av)
+			} else {
+				projected[i] = av
+			}
+		}
+		return projected
+	default:
+		return actual
+	}
+}
@@ -0,0 +1,346 @@
+package cfft
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// matcher is a special value in expect objects which matches actual values by a condition.
+// e.g. {"$regex": "^[0-9a-f]{32}$"}, {"$glob": "/images/*"}, {"$any": true}, {"$oneOf": ["a", "b"]}, {"$range": [200, 299]}
+type matcher struct {
+	name string
+	arg  any
+	re   *regexp.Regexp
+}
+
+var matcherNames = []string{"$regex", "$glob", "$any", "$oneOf", "$range"}
+
+// parseMatcher returns a matcher if v is a matcher object. v must be an object which has only one matcher key.
+func parseMatcher(v any) (*matcher, bool, error) {
+	m, ok := v.(map[string]any)
+	if !ok || len(m) != 1 {
+		return nil, false, nil
+	}
+	var name string
+	var arg any
+	for name, arg = range m {
+	}
+	if !isMatcherName(name) {
+		return nil, false, nil
+	}
+	mt := &matcher{name: name, arg: arg}
+	switch name {
+	case "$regex":
+		s, ok := arg.(string)
+		if !ok {
+			return nil, true, fmt.Errorf("$regex must be a string: %v", arg)
+		}
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, true, fmt.Errorf("invalid $regex %s, %w", s, err)
+		}
+		mt.re = re
+	case "$glob":
+		s, ok := arg.(string)
+		if !ok {
+			return nil, true, fmt.Errorf("$glob must be a string: %v", arg)
+		}
+		mt.re = globToRegexp(s)
+	case "$any":
+		if b, ok := arg.(bool); !ok || !b {
+			return nil, true, fmt.Errorf("$any must be true: %v", arg)
+		}
+	case "$oneOf":
+		if _, ok := arg.([]any); !ok {
+			return nil, true, fmt.Errorf("$oneOf must be an array: %v", arg)
+		}
+	case "$range":
+		r, ok := arg.([]any)
+		if !ok || len(r) != 2 {
+			return nil, true, fmt.Errorf("$range must be an array of [min, max]: %v", arg)
+		}
+		for _, n := range r {
+			if _, ok := n.(float64); !ok && n != nil {
+				return nil, true, fmt.Errorf("$range must be an array of [min, max] numbers or null: %v", arg)
+			}
+		}
+	}
+	return mt, true, nil
+}
+
+func isMatcherName(name string) bool {
+	for _, n := range matcherNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// globToRegexp converts a glob pattern to a regexp. * matches any characters including "/", and ? matches any single character.
+func globToRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// raw returns the matcher as the object in the expect file.
+func (m *matcher) raw() map[string]any {
+	return map[string]any{m.name: m.arg}
+}
+
+// match reports whether the actual value matches.
+func (m *matcher) match(v any) bool {
+	if _, ok := v.(missingValue); ok {
+		return false
+	}
+	switch m.name {
+	case "$regex", "$glob":
+		s, ok := v.(string)
+		return ok && m.re.MatchString(s)
+	case "$any":
+		return true
+	case "$oneOf":
+		for _, c := range m.arg.([]any) {
+			if reflect.DeepEqual(c, v) {
+				return true
+			}
+		}
+		return false
+	case "$range":
+		n, ok := v.(float64)
+		if !ok {
+			return false
+		}
+		r := m.arg.([]any)
+		if min, ok := r[0].(float64); ok && n < min {
+			return false
+		}
+		if max, ok := r[1].(float64); ok && n > max {
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// matcherPath is a matcher and its path in the expect object.
+type matcherPath struct {
+	path    []any
+	matcher *matcher
+}
+
+// extractMatchers removes the matchers from v and returns them with their paths.
+// The matchers in objects are deleted, and the matchers in arrays are replaced with null.
+func extractMatchers(v any, path []any) ([]matcherPath, error) {
+	var matchers []matcherPath
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := append(append([]any{}, path...), k)
+			m, ok, err := parseMatcher(v[k])
+			if err != nil {
+				return nil, fmt.Errorf("invalid matcher at %s, %w", formatPath(p), err)
+			}
+			if ok {
+				matchers = append(matchers, matcherPath{path: p, matcher: m})
+				delete(v, k)
+				continue
+			}
+			ms, err := extractMatchers(v[k], p)
+			if err != nil {
+				return nil, err
+			}
+			matchers = append(matchers, ms...)
+		}
+	case []any:
+		for i := range v {
+			p := append(append([]any{}, path...), i)
+			m, ok, err := parseMatcher(v[i])
+			if err != nil {
+				return nil, fmt.Errorf("invalid matcher at %s, %w", formatPath(p), err)
+			}
+			if ok {
+				matchers = append(matchers, matcherPath{path: p, matcher: m})
+				v[i] = nil
+				continue
+			}
+			ms, err := extractMatchers(v[i], p)
+			if err != nil {
+				return nil, err
+			}
+			matchers = append(matchers, ms...)
+		}
+	}
+	return matchers, nil
+}
+
+func formatPath(path []any) string {
+	var b strings.Builder
+	for _, p := range path {
+		switch p := p.(type) {
+		case string:
+			s, _ := json.Marshal(p)
+			fmt.Fprintf(&b, "[%s]", s)
+		case int:
+			fmt.Fprintf(&b, "[%d]", p)
+		}
+	}
+	return b.String()
+}
+
+// setPath sets value at the path in v. Missing objects in the path are created.
+func setPath(v any, path []any, value any) {
+	if len(path) == 0 {
+		return
+	}
+	switch p := path[0].(type) {
+	case string:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return
+		}
+		if len(path) == 1 {
+			m[p] = value
+			return
+		}
+		if _, ok := m[p]; !ok {
+			m[p] = map[string]any{}
+		}
+		setPath(m[p], path[1:], value)
+	case int:
+		a, ok := v.([]any)
+		if !ok || p >= len(a) {
+			return
+		}
+		if len(path) == 1 {
+			a[p] = value
+			return
+		}
+		setPath(a[p], path[1:], value)
+	}
+}
+
+// applyMatchers returns a copy of expect whose matchers are replaced with the actual values if they match.
+// The matchers which do not match are left as the objects in the expect file, so they are reported in the diff.
+func applyMatchers(expect, actual any) any {
+	switch e := expect.(type) {
+	case *matcher:
+		if e.match(actual) {
+			return actual
+		}
+		return e.raw()
+	case map[string]any:
+		a, _ := actual.(map[string]any)
+		m := make(map[string]any, len(e))
+		for k, ev := range e {
+			av, ok := a[k]
+			if !ok {
+				// missing in actual
+				m[k] = applyMatchers(ev, missingValue{})
+				continue
+			}
+			m[k] = applyMatchers(ev, av)
+		}
+		return m
+	case []any:
+		a, _ := actual.([]any)
+		s := make([]any, len(e))
+		for i, ev := range e {
+			if i < len(a) {
+				s[i] = applyMatchers(ev, a[i])
+			} else {
+				s[i] = applyMatchers(ev, missingValue{})
+			}
+		}
+		return s
+	default:
+		return e
+	}
+}
+
+// keepMatchers returns a copy of actual which keeps the matchers in expect matching the actual values.
+func keepMatchers(expect, actual any) any {
+	switch e := expect.(type) {
+	case *matcher:
+		if e.match(actual) {
+			return e.raw()
+		}
+		return actual
+	case map[string]any:
+		a, ok := actual.(map[string]any)
+		if !ok {
+			return actual
+		}
+		m := make(map[string]any, len(a))
+		for k, av := range a {
+			if ev, ok := e[k]; ok {
+				m[k] = keepMatchers(ev, av)
+			} else {
+				m[k] = av
+			}
+		}
+		return m
+	case []any:
+		a, ok := actual.([]any)
+		if !ok {
+			return actual
+		}
+		s := make([]any, len(a))
+		for i, av := range a {
+			if i < len(e) {
+				s[i] = keepMatchers(e[i], av)
+			} else {
+				s[i] = av
+			}
+		}
+		return s
+	default:
+		return actual
+	}
+}
+
+// rawMatchers returns a copy of v whose matchers are replaced with the objects in the expect file.
+func rawMatchers(v any) any {
+	switch v := v.(type) {
+	case *matcher:
+		return v.raw()
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, vv := range v {
+			m[k] = rawMatchers(vv)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, vv := range v {
+			s[i] = rawMatchers(vv)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+// missingValue represents a value missing in the actual object. It matches no matchers.
+type missingValue struct{}
@@ -0,0 +1,125 @@
+package cfft_test
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/cfft"
+)
+
+const matcherTestOutput = `{"response":{"statusCode":200,"headers":{"x-request-id":{"value":"0123456789abcdef0123456789abcdef"},"date":{"value":"Mon, 01 Jan 2024 00:00:00 GMT"},"location":{"value":"/images/a/b.png"}},"cookies":{}}}`
+
+var matcherTests = []struct {
+	name   string
+	match  string
+	expect string
+	diff   []string
+	err    string
+}{
+	{
+		name: "matched",
+		expect: `{"response":{"statusCode":{"$oneOf":[200,304]},"headers":{
+			"x-request-id":{"value":{"$regex":"^[0-9a-f]{32}$"}},
+			"date":{"$any":true},
+			"location":{"value":{"$glob":"/images/*.png"}}
+		},"cookies":{}}}`,
+	},
+	{
+		name:   "regex mismatch",
+		expect: `{"response":{"statusCode":200,"headers":{"x-request-id":{"value":{"$regex":"^[0-9]+$"}},"date":{"$any":true},"location":{"$any":true}}}}`,
+		diff:   []string{`"$regex": "^[0-9]+$"`, `"0123456789abcdef0123456789abcdef"`},
+	},
+	{
+		name:   "range mismatch",
+		expect: `{"response":{"statusCode":{"$range":[300,399]},"headers":{"x-request-id":{"$any":true},"date":{"$any":true},"location":{"$any":true}}}}`,
+		diff:   []string{`"$range"`, `"statusCode": 200`},
+	},
+	{
+		name:   "any missing",
+		expect: `{"response":{"statusCode":{"$range":[200,null]},"headers":{"x-request-id":{"$any":true},"date":{"$any":true},"location":{"$any":true},"x-missing":{"$any":true}}}}`,
+		diff:   []string{`"x-missing"`},
+	},
+	{
+		name:   "subset",
+		match:  "subset",
+		expect: `{"response":{"headers":{"x-request-id":{"value":{"$regex":"^[0-9a-f]+$"}}}}}`,
+	},
+	{
+		name:   "invalid regex",
+		expect: `{"response":{"statusCode":{"$regex":"("}}}`,
+		err:    `invalid matcher at ["response"]["statusCode"]`,
+	},
+	{
+		name:   "invalid range",
+		expect: `{"response":{"statusCode":{"$range":[200]}}}`,
+		err:    "$range must be an array of [min, max]",
+	},
+}
+
+func TestMatchers(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	for _, tt := range matcherTests {
+		t.Run(tt.name, func(t *testing.T) {
+			testCase := &cfft.TestCase{
+				Event:  "testdata/event.json",
+				Expect: "expect.json",
+				Match:  tt.match,
+			}
+			readFile := func(p string) ([]byte, error) {
+				if p == "expect.json" {
+					return []byte(tt.expect), nil
+				}
+				return cfft.ReadFile(p)
+			}
+			err := testCase.Setup(ctx, readFile)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = testCase.Run(ctx, &cfft.FunctionResult{Output: []byte(matcherTestOutput)}, slog.Default(), io.Discard)
+			if len(tt.diff) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			var derr *cfft.DiffError
+			if !errors.As(err, &derr) {
+				t.Fatalf("expected diff error, got %v", err)
+			}
+			for _, d := range tt.diff {
+				if !strings.Contains(derr.Diff, d) {
+					t.Errorf("diff must contain %q\n%s", d, derr.Diff)
+				}
+			}
+		})
+	}
+}
+
+func TestExpectBytesWithMatchers(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	testCase := &cfft.TestCase{
+		Event:  "testdata/event.json",
+		Expect: "expect.json",
+	}
+	readFile := func(p string) ([]byte, error) {
+		if p == "expect.json" {
+			return []byte(`{"response":{"statusCode":200,"headers":{"x-id":{"value":{"$regex":"^abc[0-9]+$"}}}}}`), nil
+		}
+		return cfft.ReadFile(p)
+	}
+	if err := testCase.Setup(ctx, readFile); err != nil {
+		t.Fatal(err)
+	}
+	if b := string(testCase.ExpectBytes()); !strings.Contains(b, `"x-id":{"value":{"$regex":"^abc[0-9]+$"}}`) {
+		t.Errorf("matchers must be rendered: %s", b)
+	}
+}
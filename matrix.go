@@ -0,0 +1,100 @@
+package cfft
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TestCaseMatrix is the combinations of variables to expand a test case into multiple test cases.
+//
+// It is an object of variable names to the lists of values, which are expanded into all the combinations,
+// or a list of objects which are the combinations of variables.
+type TestCaseMatrix []map[string]string
+
+func (m *TestCaseMatrix) UnmarshalJSON(b []byte) error {
+	var list []map[string]json.RawMessage
+	if err := json.Unmarshal(b, &list); err == nil {
+		for _, vars := range list {
+			combination := make(map[string]string, len(vars))
+			for k, v := range vars {
+				combination[k] = matrixValue(v)
+			}
+			*m = append(*m, combination)
+		}
+		return nil
+	}
+
+	var vars map[string][]json.RawMessage
+	if err := json.Unmarshal(b, &vars); err != nil {
+		return fmt.Errorf("matrix must be an object of lists or a list of objects, %w", err)
+	}
+	keys := make([]string, 0, len(vars))
+	for k, values := range vars {
+		if len(values) == 0 {
+			return fmt.Errorf("matrix variable %s has no values", k)
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	combinations := []map[string]string{{}}
+	for _, k := range keys {
+		var next []map[string]string
+		for _, c := range combinations {
+			for _, v := range vars[k] {
+				nc := make(map[string]string, len(c)+1)
+				for ck, cv := range c {
+					nc[ck] = cv
+				}
+				nc[k] = matrixValue(v)
+				next = append(next, nc)
+			}
+		}
+		combinations = next
+	}
+	*m = combinations
+	return nil
+}
+
+// matrixValue returns the value as a string. Values which are not strings are JSON strings.
+func matrixValue(v json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(v, &s); err == nil {
+		return s
+	}
+	return string(v)
+}
+
+// expandMatrix expands the test cases which have matrix into multiple test cases.
+// The variables are set to Env of the expanded test cases, and the names are generated from the variables.
+func expandMatrix(cases []*TestCase) []*TestCase {
+	expanded := make([]*TestCase, 0, len(cases))
+	for _, tc := range cases {
+		if len(tc.Matrix) == 0 {
+			expanded = append(expanded, tc)
+			continue
+		}
+		for _, vars := range tc.Matrix {
+			c := *tc
+			c.Matrix = nil
+			c.Env = make(map[string]string, len(tc.Env)+len(vars))
+			for k, v := range tc.Env {
+				c.Env[k] = v
+			}
+			keys := make([]string, 0, len(vars))
+			for k, v := range vars {
+				c.Env[k] = v
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			params := make([]string, 0, len(keys))
+			for _, k := range keys {
+				params = append(params, k+"="+vars[k])
+			}
+			c.Name = f("%s[%s]", tc.Name, strings.Join(params, ","))
+			expanded = append(expanded, &c)
+		}
+	}
+	return expanded
+}
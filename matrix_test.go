@@ -0,0 +1,90 @@
+package cfft_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/cfft"
+)
+
+var matrixTests = []struct {
+	name   string
+	src    string
+	expect []string
+	err    bool
+}{
+	{
+		name:   "list",
+		src:    `{"name":"lookup","env":{"FOO":"foo"},"matrix":[{"IP":"127.0.0.1","HOSTNAME":"localhost"},{"IP":"192.168.1.1","HOSTNAME":"home"}]}`,
+		expect: []string{"lookup[HOSTNAME=localhost,IP=127.0.0.1]", "lookup[HOSTNAME=home,IP=192.168.1.1]"},
+	},
+	{
+		name:   "object",
+		src:    `{"name":"methods","matrix":{"URI":["/","/index.html"],"METHOD":["GET","POST"],"N":[1]}}`,
+		expect: []string{"methods[METHOD=GET,N=1,URI=/]", "methods[METHOD=GET,N=1,URI=/index.html]", "methods[METHOD=POST,N=1,URI=/]", "methods[METHOD=POST,N=1,URI=/index.html]"},
+	},
+	{
+		name:   "no matrix",
+		src:    `{"name":"plain"}`,
+		expect: []string{"plain"},
+	},
+	{
+		name: "empty values",
+		src:  `{"name":"empty","matrix":{"FOO":[]}}`,
+		err:  true,
+	},
+}
+
+func TestMatrix(t *testing.T) {
+	for _, tt := range matrixTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tc cfft.TestCase
+			err := json.Unmarshal([]byte(tt.src), &tc)
+			if tt.err {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, c := range cfft.ExpandMatrix([]*cfft.TestCase{&tc}) {
+				names = append(names, c.Name)
+				if c.Matrix != nil {
+					t.Errorf("matrix of %s must be cleared", c.Name)
+				}
+				if tc.Env["FOO"] != "" && c.Env["FOO"] != tc.Env["FOO"] {
+					t.Errorf("env of %s must be inherited: %v", c.Name, c.Env)
+				}
+			}
+			if strings.Join(names, " ") != strings.Join(tt.expect, " ") {
+				t.Errorf("unexpected test cases: %v, expected %v", names, tt.expect)
+			}
+		})
+	}
+}
+
+func TestMatrixConfig(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	conf, err := cfft.LoadConfig(ctx, "testdata/true-client-ip/cfft.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.TestCases) != 3 {
+		t.Fatalf("unexpected number of test cases: %d", len(conf.TestCases))
+	}
+	for _, ip := range []string{"127.0.0.1", "192.168.1.1"} {
+		found := false
+		for _, cs := range conf.TestCases {
+			if strings.Contains(string(cs.EventBytes()), `"ip":"`+ip+`"`) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("event with ip %s is not found", ip)
+		}
+	}
+}
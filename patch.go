@@ -0,0 +1,313 @@
+package cfft
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// patchEvent applies the patch to the event object.
+//
+// The patch is a JSON Merge Patch (RFC 7396) object or a JSON Patch (RFC 6902) array.
+// In the JSON Merge Patch, request and response may be HTTP text fragments, which are merged into the base objects.
+func patchEvent(event []byte, patch json.RawMessage) ([]byte, error) {
+	var doc any
+	if err := json.Unmarshal(event, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse base event, %w", err)
+	}
+	var p any
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse patch, %w", err)
+	}
+	switch p := p.(type) {
+	case map[string]any:
+		if err := parseHTTPTextPatch(p); err != nil {
+			return nil, err
+		}
+		doc = mergePatch(doc, p)
+	case []any:
+		var ops []jsonPatchOperation
+		if err := json.Unmarshal(patch, &ops); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON Patch, %w", err)
+		}
+		for i, op := range ops {
+			var err error
+			if doc, err = op.apply(doc); err != nil {
+				return nil, fmt.Errorf("failed to apply JSON Patch operation[%d] %s %s, %w", i, op.Op, op.Path, err)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("patch must be an object (JSON Merge Patch) or an array (JSON Patch)")
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal patched event, %w", err)
+	}
+	return b, nil
+}
+
+// parseHTTPTextPatch replaces request and response in the HTTP text format with the objects.
+func parseHTTPTextPatch(p map[string]any) error {
+	for key, parse := range map[string]func(string) (any, error){
+		"request": func(s string) (any, error) {
+			return ParseRequest(s)
+		},
+		"response": func(s string) (any, error) {
+			return ParseResponse(s)
+		},
+	} {
+		s, ok := p[key].(string)
+		if !ok {
+			continue
+		}
+		v, err := parse(s)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s of patch, %w", key, err)
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s of patch, %w", key, err)
+		}
+		var m map[string]any
+		if err := json.Unmarshal(b, &m); err != nil {
+			return fmt.Errorf("failed to parse %s of patch, %w", key, err)
+		}
+		p[key] = m
+	}
+	return nil
+}
+
+// mergePatch applies the JSON Merge Patch (RFC 7396) to the target.
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+// jsonPatchOperation is an operation of the JSON Patch (RFC 6902).
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func (op jsonPatchOperation) value() (any, error) {
+	if op.Value == nil {
+		return nil, fmt.Errorf("value is required")
+	}
+	var v any
+	if err := json.Unmarshal(op.Value, &v); err != nil {
+		return nil, fmt.Errorf("failed to parse value, %w", err)
+	}
+	return v, nil
+}
+
+func (op jsonPatchOperation) apply(doc any) (any, error) {
+	switch op.Op {
+	case "add":
+		v, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, op.Path, v)
+	case "remove":
+		doc, _, err := pointerRemove(doc, op.Path)
+		return doc, err
+	case "replace":
+		v, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		if doc, _, err = pointerRemove(doc, op.Path); err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, op.Path, v)
+	case "move":
+		doc, v, err := pointerRemove(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, op.Path, v)
+	case "copy":
+		v, err := pointerGet(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, op.Path, deepCopyJSON(v))
+	case "test":
+		v, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		actual, err := pointerGet(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(v, actual) {
+			return nil, fmt.Errorf("test failed, the value is %v", actual)
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("unsupported operation %q", op.Op)
+	}
+}
+
+// parsePointer parses the JSON Pointer (RFC 6901) into the reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON Pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+	i, err := strconv.Atoi(token)
+	max := length - 1
+	if allowEnd {
+		max = length
+	}
+	if err != nil || i < 0 || i > max || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return i, nil
+}
+
+func pointerGet(doc any, pointer string) (any, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tokens {
+		switch d := doc.(type) {
+		case map[string]any:
+			v, ok := d[t]
+			if !ok {
+				return nil, fmt.Errorf("%s is not found", pointer)
+			}
+			doc = v
+		case []any:
+			i, err := arrayIndex(t, len(d), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = d[i]
+		default:
+			return nil, fmt.Errorf("%s is not found", pointer)
+		}
+	}
+	return doc, nil
+}
+
+// pointerAdd adds the value at the pointer and returns the new document.
+func pointerAdd(doc any, pointer string, value any) (any, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	parent, err := pointerGet(doc, pointer[:strings.LastIndex(pointer, "/")])
+	if err != nil {
+		return nil, err
+	}
+	last := tokens[len(tokens)-1]
+	switch p := parent.(type) {
+	case map[string]any:
+		p[last] = value
+		return doc, nil
+	case []any:
+		i, err := arrayIndex(last, len(p), true)
+		if err != nil {
+			return nil, err
+		}
+		a := append(p[:i:i], value)
+		a = append(a, p[i:]...)
+		return replaceAt(doc, tokens[:len(tokens)-1], a), nil
+	default:
+		return nil, fmt.Errorf("parent of %s is not a container", pointer)
+	}
+}
+
+// pointerRemove removes the value at the pointer and returns the new document and the removed value.
+func pointerRemove(doc any, pointer string) (any, any, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, doc, nil
+	}
+	parent, err := pointerGet(doc, pointer[:strings.LastIndex(pointer, "/")])
+	if err != nil {
+		return nil, nil, err
+	}
+	last := tokens[len(tokens)-1]
+	switch p := parent.(type) {
+	case map[string]any:
+		v, ok := p[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("%s is not found", pointer)
+		}
+		delete(p, last)
+		return doc, v, nil
+	case []any:
+		i, err := arrayIndex(last, len(p), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		v := p[i]
+		a := append(p[:i:i], p[i+1:]...)
+		return replaceAt(doc, tokens[:len(tokens)-1], a), v, nil
+	default:
+		return nil, nil, fmt.Errorf("%s is not found", pointer)
+	}
+}
+
+// replaceAt replaces the value at the tokens with v and returns the new document.
+func replaceAt(doc any, tokens []string, v any) any {
+	if len(tokens) == 0 {
+		return v
+	}
+	switch d := doc.(type) {
+	case map[string]any:
+		d[tokens[0]] = replaceAt(d[tokens[0]], tokens[1:], v)
+	case []any:
+		i, _ := strconv.Atoi(tokens[0])
+		d[i] = replaceAt(d[i], tokens[1:], v)
+	}
+	return doc
+}
+
+func deepCopyJSON(v any) any {
+	b, _ := json.Marshal(v)
+	var c any
+	_ = json.Unmarshal(b, &c)
+	return c
+}
@@ -0,0 +1,108 @@
+package cfft_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/fujiwara/cfft"
+	"github.com/google/go-cmp/cmp"
+)
+
+const patchBaseEvent = `{"context":{"eventType":"viewer-request"},"request":{"method":"GET","uri":"/","headers":{"host":{"value":"example.com"}},"cookies":{},"querystring":{}},"list":[1,2]}`
+
+var patchEventTests = []struct {
+	name   string
+	patch  string
+	expect string
+	err    bool
+}{
+	{
+		name:   "merge patch",
+		patch:  `{"request":{"uri":"/foo","headers":{"host":null,"x-foo":{"value":"bar"}}}}`,
+		expect: `{"context":{"eventType":"viewer-request"},"request":{"method":"GET","uri":"/foo","headers":{"x-foo":{"value":"bar"}},"cookies":{},"querystring":{}},"list":[1,2]}`,
+	},
+	{
+		name:   "http text fragment",
+		patch:  `{"request":"POST /bar HTTP/1.1\nX-Foo: bar\n"}`,
+		expect: `{"context":{"eventType":"viewer-request"},"request":{"method":"POST","uri":"/bar","headers":{"host":{"value":"example.com"},"x-foo":{"value":"bar"}},"cookies":{},"querystring":{}},"list":[1,2]}`,
+	},
+	{
+		name: "json patch",
+		patch: `[
+			{"op":"test","path":"/request/uri","value":"/"},
+			{"op":"replace","path":"/request/uri","value":"/baz"},
+			{"op":"add","path":"/request/headers/x~1foo","value":{"value":"bar"}},
+			{"op":"copy","from":"/request/headers/host","path":"/request/headers/x-host"},
+			{"op":"move","from":"/request/headers/host","path":"/request/headers/origin"},
+			{"op":"add","path":"/list/-","value":3},
+			{"op":"add","path":"/list/0","value":0},
+			{"op":"remove","path":"/list/1"}
+		]`,
+		expect: `{"context":{"eventType":"viewer-request"},"request":{"method":"GET","uri":"/baz","headers":{"x/foo":{"value":"bar"},"x-host":{"value":"example.com"},"origin":{"value":"example.com"}},"cookies":{},"querystring":{}},"list":[0,2,3]}`,
+	},
+	{
+		name:  "json patch test failed",
+		patch: `[{"op":"test","path":"/request/uri","value":"/foo"}]`,
+		err:   true,
+	},
+	{
+		name:  "json patch not found",
+		patch: `[{"op":"remove","path":"/request/nothing"}]`,
+		err:   true,
+	},
+	{
+		name:  "invalid patch",
+		patch: `"foo"`,
+		err:   true,
+	},
+}
+
+func TestPatchEvent(t *testing.T) {
+	for _, tt := range patchEventTests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := cfft.PatchEvent([]byte(patchBaseEvent), json.RawMessage(tt.patch))
+			if tt.err {
+				if err == nil {
+					t.Errorf("expected error, got %s", string(b))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var actual, expect any
+			if err := json.Unmarshal(b, &actual); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.expect), &expect); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(expect, actual); diff != "" {
+				t.Errorf("unexpected patched event (-expect +actual):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBaseEvent(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	testCase := &cfft.TestCase{
+		BaseEvent: "testdata/event.json",
+		Patch:     json.RawMessage(`{"viewer":{"ip":"192.0.2.1"}}`),
+	}
+	if err := testCase.Setup(ctx, cfft.ReadFile); err != nil {
+		t.Fatal(err)
+	}
+	if ip := testCase.GetEvent().Viewer.IP; ip != "192.0.2.1" {
+		t.Errorf("unexpected viewer ip: %s", ip)
+	}
+
+	for _, tc := range []*cfft.TestCase{
+		{Event: "testdata/event.json", BaseEvent: "testdata/event.json"},
+		{Event: "testdata/event.json", Patch: json.RawMessage(`{}`)},
+	} {
+		if err := tc.Setup(ctx, cfft.ReadFile); err == nil {
+			t.Errorf("expected error for %#v", tc)
+		}
+	}
+}
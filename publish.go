@@ -12,6 +12,20 @@ import (
 )
 
 type PublishCmd struct {
+	Test *bool `help:"run the test cases against the DEVELOPMENT function and publish only if all of them pass. default is publish.test in config" negatable:""`
+}
+
+// PublishConfig is the configuration for the publish command.
+type PublishConfig struct {
+	Test bool `json:"test" yaml:"test"`
+}
+
+// shouldTestBeforePublish reports whether the publish command runs the test cases before publishing.
+func (app *CFFT) shouldTestBeforePublish(opt *PublishCmd) bool {
+	if opt != nil && opt.Test != nil {
+		return *opt.Test
+	}
+	return app.config.Publish != nil && app.config.Publish.Test
 }
 
 func (app *CFFT) PublishFunction(ctx context.Context, opt *PublishCmd) error {
@@ -41,6 +55,20 @@ func (app *CFFT) PublishFunction(ctx context.Context, opt *PublishCmd) error {
 		return fmt.Errorf("function code is not up-to-date. please run `cfft diff` and `cfft test` before publish")
 	}
 
+	if app.shouldTestBeforePublish(opt) {
+		// always test the DEVELOPMENT function on CloudFront, not the local code
+		runner := &CFFRunner{cloudfront: app.cloudfront, stage: Stage}
+		if err := app.testBeforePublish(ctx, runner, etag, app.developmentETag); err != nil {
+			return err
+		}
+	}
+
+	// the current LIVE function is archived to roll back, only after it is replaced by the publish
+	archive, err := app.liveArchiveEntry(ctx, ArchiveReasonPublish)
+	if err != nil {
+		return err
+	}
+
 	slog.Info(f("publishing function %s...", name))
 	if _, err := app.cloudfront.PublishFunction(ctx, &cloudfront.PublishFunctionInput{
 		Name:    aws.String(name),
@@ -49,5 +77,49 @@ func (app *CFFT) PublishFunction(ctx context.Context, opt *PublishCmd) error {
 		return fmt.Errorf("failed to publish function, %w", err)
 	}
 	slog.Info(f("function %s published successfully", name))
+	return app.saveArchive(ctx, archive)
+}
+
+// testBeforePublish runs all the test cases by the runner against the DEVELOPMENT function of the etag.
+// It fails if there are no test cases, if any test case is skipped, or if the function is updated during the test (currentETag returns another ETag),
+// to publish only the tested code.
+func (app *CFFT) testBeforePublish(ctx context.Context, runner FunctionRunner, etag string, currentETag func(context.Context) (string, error)) error {
+	name := app.config.Name
+	if len(app.config.TestCases) == 0 {
+		return fmt.Errorf("no test cases, function %s is not published. add test cases to publish with --test", name)
+	}
+	// skip and only in the config must not let untested code go to LIVE
+	for _, testCase := range app.config.TestCases {
+		if testCase.Skip != "" {
+			return fmt.Errorf("test case %s is skipped (%s), function %s is not published. remove skip to publish with --test", testCase.Identifier(), testCase.Skip, name)
+		}
+		if testCase.Only {
+			return fmt.Errorf("test case %s has only, function %s is not published. remove only to publish with --test", testCase.Identifier(), name)
+		}
+	}
+	slog.Info(f("testing function %s (ETag %s) before publish", name, etag))
+	app.runner = runner
+	if err := app.runTests(ctx, &TestCmd{}, etag, app.config.TestCases); err != nil {
+		return fmt.Errorf("test failed, function %s is not published, %w", name, err)
+	}
+	current, err := currentETag(ctx)
+	if err != nil {
+		return err
+	}
+	if current != etag {
+		return fmt.Errorf("function %s was updated during the test (ETag %s -> %s). not published", name, etag, current)
+	}
 	return nil
 }
+
+// developmentETag returns the current ETag of the DEVELOPMENT function.
+func (app *CFFT) developmentETag(ctx context.Context) (string, error) {
+	res, err := app.cloudfront.DescribeFunction(ctx, &cloudfront.DescribeFunctionInput{
+		Name:  aws.String(app.config.Name),
+		Stage: Stage,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe function, %w", err)
+	}
+	return aws.ToString(res.ETag), nil
+}
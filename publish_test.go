@@ -0,0 +1,139 @@
+package cfft_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+	"github.com/fujiwara/cfft"
+)
+
+func TestShouldTestBeforePublish(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	yes, no := true, false
+	for _, tt := range []struct {
+		config *cfft.PublishConfig
+		flag   *bool
+		expect bool
+	}{
+		{config: nil, flag: nil, expect: false},
+		{config: &cfft.PublishConfig{Test: true}, flag: nil, expect: true},
+		{config: &cfft.PublishConfig{Test: true}, flag: &no, expect: false},
+		{config: nil, flag: &yes, expect: true},
+	} {
+		conf, err := cfft.LoadConfig(ctx, "testdata/funcv2/cfft.yaml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf.Publish = tt.config
+		app, err := cfft.New(ctx, conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := app.ShouldTestBeforePublish(&cfft.PublishCmd{Test: tt.flag}); got != tt.expect {
+			t.Errorf("unexpected result for config %v and flag %v: %v", tt.config, tt.flag, got)
+		}
+	}
+}
+
+// recordingRunner records the ETags which the test cases run against.
+type recordingRunner struct {
+	cfft.FunctionRunner
+	etags []string
+}
+
+func (r *recordingRunner) Run(ctx context.Context, name, etag string, event []byte, logger *slog.Logger) (*cfft.FunctionResult, error) {
+	r.etags = append(r.etags, etag)
+	return r.FunctionRunner.Run(ctx, name, etag, event, logger)
+}
+
+var testBeforePublishTests = []struct {
+	name    string
+	code    string
+	skip    string
+	only    bool
+	empty   bool
+	current string
+	run     bool
+	err     bool
+}{
+	{
+		name:    "pass",
+		code:    `function handler(event) { return event.request; }`,
+		current: "E1",
+		run:     true,
+	},
+	{
+		name:    "failed",
+		code:    `function handler(event) { throw new Error('broken'); }`,
+		current: "E1",
+		run:     true,
+		err:     true,
+	},
+	{
+		name:    "skipped",
+		code:    `function handler(event) { return event.request; }`,
+		skip:    "wip",
+		current: "E1",
+		err:     true,
+	},
+	{
+		name:    "only",
+		code:    `function handler(event) { return event.request; }`,
+		only:    true,
+		current: "E1",
+		err:     true,
+	},
+	{
+		name:    "no test cases",
+		code:    `function handler(event) { return event.request; }`,
+		empty:   true,
+		current: "E1",
+		err:     true,
+	},
+	{
+		name:    "etag changed",
+		code:    `function handler(event) { return event.request; }`,
+		current: "E2",
+		run:     true,
+		err:     true,
+	},
+}
+
+func TestTestBeforePublish(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	for _, tt := range testBeforePublishTests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, err := cfft.LoadConfig(ctx, "testdata/funcv2/cfft.yaml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			conf.TestCases[0].Skip = tt.skip
+			conf.TestCases[0].Only = tt.only
+			if tt.empty {
+				conf.TestCases = nil
+			}
+			app, err := cfft.New(ctx, conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			runner := &recordingRunner{FunctionRunner: cfft.NewLocalRunner([]byte(tt.code), types.FunctionRuntimeCloudfrontJs20)}
+			err = app.TestBeforePublish(ctx, runner, "E1", func(context.Context) (string, error) {
+				return tt.current, nil
+			})
+			if tt.err && err == nil {
+				t.Error("expected error, publish must be blocked")
+			} else if !tt.err && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.run {
+				if len(runner.etags) != 1 || runner.etags[0] != "E1" {
+					t.Errorf("test cases must run against ETag E1: %v", runner.etags)
+				}
+			} else if len(runner.etags) != 0 {
+				t.Errorf("test cases must not run: %v", runner.etags)
+			}
+		})
+	}
+}
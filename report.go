@@ -0,0 +1,285 @@
+package cfft
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ReportFormatJUnit = "junit"
+	ReportFormatJSON  = "json"
+)
+
+const (
+	TestCaseStatusPassed  = "passed"
+	TestCaseStatusFailed  = "failed"
+	TestCaseStatusSkipped = "skipped"
+)
+
+// TestCaseResult is the result of a test case.
+type TestCaseResult struct {
+	Name               string
+	ETag               string
+	Duration           time.Duration
+	ComputeUtilization int
+	Logs               []string
+	Output             []byte
+	Diff               string
+	Err                error
+	Skipped            string // the reason why the test case was skipped
+}
+
+func (r *TestCaseResult) Status() string {
+	if r.Skipped != "" {
+		return TestCaseStatusSkipped
+	}
+	if r.Err != nil {
+		return TestCaseStatusFailed
+	}
+	return TestCaseStatusPassed
+}
+
+func newTestCaseResult(cs *TestCase, etag string, d time.Duration, res *FunctionResult, err error) *TestCaseResult {
+	r := &TestCaseResult{
+		Name:     cs.Identifier(),
+		ETag:     etag,
+		Duration: d,
+		Err:      err,
+	}
+	var ferr *FunctionError
+	if res != nil {
+		r.ComputeUtilization = res.ComputeUtilization
+		r.Logs = res.Logs
+		r.Output = res.Output
+	} else if errors.As(err, &ferr) {
+		// the logs of the function which threw an error
+		r.ComputeUtilization = ferr.ComputeUtilization
+		r.Logs = ferr.Logs
+	}
+	var derr *DiffError
+	var lerr *LiveDiffError
+	if errors.As(err, &derr) {
+		r.Diff = derr.Diff
+	} else if errors.As(err, &lerr) {
+		r.Diff = lerr.Diff
+	}
+	return r
+}
+
+type reportOption struct {
+	format string
+	path   string
+}
+
+// parseReportOptions parses FORMAT=PATH report options.
+func parseReportOptions(opts []string) ([]reportOption, error) {
+	var reports []reportOption
+	for _, o := range opts {
+		format, path, ok := strings.Cut(o, "=")
+		if !ok || path == "" {
+			return nil, fmt.Errorf("invalid report option %s, must be FORMAT=PATH", o)
+		}
+		switch format {
+		case ReportFormatJUnit, ReportFormatJSON:
+		default:
+			return nil, fmt.Errorf("unsupported report format %s", format)
+		}
+		reports = append(reports, reportOption{format: format, path: path})
+	}
+	return reports, nil
+}
+
+func hasStdoutReport(reports []reportOption) bool {
+	for _, r := range reports {
+		if r.path == "-" {
+			return true
+		}
+	}
+	return false
+}
+
+func (app *CFFT) writeReports(reports []reportOption, results []*TestCaseResult) error {
+	for _, r := range reports {
+		if err := app.writeReport(r, results); err != nil {
+			return fmt.Errorf("failed to write %s report to %s, %w", r.format, r.path, err)
+		}
+	}
+	return nil
+}
+
+func (app *CFFT) writeReport(r reportOption, results []*TestCaseResult) error {
+	var w io.Writer
+	if r.path == "-" {
+		w = app.stdout
+	} else {
+		fp, err := os.Create(r.path)
+		if err != nil {
+			return err
+		}
+		defer fp.Close()
+		w = fp
+	}
+	switch r.format {
+	case ReportFormatJUnit:
+		return writeJUnitReport(w, app.config.Name, results)
+	case ReportFormatJSON:
+		return writeJSONReport(w, app.config.Name, results)
+	}
+	return nil
+}
+
+type junitTestSuites struct {
+	XMLName    xml.Name         `xml:"testsuites"`
+	TestSuites []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name       string          `xml:"name,attr"`
+	ClassName  string          `xml:"classname,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Failure    *junitFailure   `xml:"failure,omitempty"`
+	Skipped    *junitSkipped   `xml:"skipped,omitempty"`
+	SystemOut  string          `xml:"system-out,omitempty"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+func junitTime(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// writeJUnitReport writes the results as JUnit XML. Each test case is a testcase element.
+func writeJUnitReport(w io.Writer, name string, results []*TestCaseResult) error {
+	suite := junitTestSuite{
+		Name:  name,
+		Tests: len(results),
+	}
+	var total time.Duration
+	for _, r := range results {
+		total += r.Duration
+		tc := junitTestCase{
+			Name:      r.Name,
+			ClassName: name,
+			Time:      junitTime(r.Duration),
+			SystemOut: strings.Join(r.Logs, "\n"),
+		}
+		if r.ComputeUtilization > 0 {
+			tc.Properties = []junitProperty{
+				{Name: "ComputeUtilization", Value: strconv.Itoa(r.ComputeUtilization)},
+			}
+		}
+		if r.Skipped != "" {
+			suite.Skipped++
+			tc.Skipped = &junitSkipped{Message: r.Skipped}
+		} else if r.Err != nil {
+			suite.Failures++
+			if r.Diff != "" {
+				tc.Failure = &junitFailure{Message: r.Diff, Body: r.Diff}
+			} else {
+				tc.Failure = &junitFailure{Message: r.Err.Error(), Body: r.Err.Error()}
+			}
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	suite.Time = junitTime(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{TestSuites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type jsonReport struct {
+	Name      string               `json:"name"`
+	Passed    int                  `json:"passed"`
+	Failed    int                  `json:"failed"`
+	Skipped   int                  `json:"skipped"`
+	TestCases []jsonTestCaseResult `json:"testCases"`
+}
+
+type jsonTestCaseResult struct {
+	Name               string          `json:"name"`
+	Status             string          `json:"status"`
+	ETag               string          `json:"etag,omitempty"`
+	Duration           float64         `json:"duration"`
+	ComputeUtilization int             `json:"computeUtilization"`
+	Logs               []string        `json:"logs"`
+	Output             json.RawMessage `json:"output,omitempty"`
+	Diff               string          `json:"diff,omitempty"`
+	Error              string          `json:"error,omitempty"`
+	SkipReason         string          `json:"skipReason,omitempty"`
+}
+
+// writeJSONReport writes the results as JSON. duration is in seconds.
+func writeJSONReport(w io.Writer, name string, results []*TestCaseResult) error {
+	report := jsonReport{
+		Name:      name,
+		TestCases: make([]jsonTestCaseResult, 0, len(results)),
+	}
+	for _, r := range results {
+		jr := jsonTestCaseResult{
+			Name:               r.Name,
+			Status:             r.Status(),
+			ETag:               r.ETag,
+			Duration:           r.Duration.Seconds(),
+			ComputeUtilization: r.ComputeUtilization,
+			Logs:               r.Logs,
+			Diff:               r.Diff,
+		}
+		if jr.Logs == nil {
+			jr.Logs = []string{}
+		}
+		if json.Valid(r.Output) {
+			jr.Output = r.Output
+		}
+		switch r.Status() {
+		case TestCaseStatusSkipped:
+			report.Skipped++
+			jr.SkipReason = r.Skipped
+		case TestCaseStatusFailed:
+			report.Failed++
+			jr.Error = r.Err.Error()
+		default:
+			report.Passed++
+		}
+		report.TestCases = append(report.TestCases, jr)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -0,0 +1,295 @@
+package cfft_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/cfft"
+	"github.com/google/go-cmp/cmp"
+)
+
+type junitReport struct {
+	TestSuites []struct {
+		Name      string `xml:"name,attr"`
+		Tests     int    `xml:"tests,attr"`
+		Failures  int    `xml:"failures,attr"`
+		Skipped   int    `xml:"skipped,attr"`
+		TestCases []struct {
+			Name       string `xml:"name,attr"`
+			Time       string `xml:"time,attr"`
+			Properties []struct {
+				Name  string `xml:"name,attr"`
+				Value string `xml:"value,attr"`
+			} `xml:"properties>property"`
+			Failure *struct {
+				Message string `xml:"message,attr"`
+			} `xml:"failure"`
+			Skipped *struct {
+				Message string `xml:"message,attr"`
+			} `xml:"skipped"`
+			SystemOut string `xml:"system-out"`
+		} `xml:"testcase"`
+	} `xml:"testsuite"`
+}
+
+func TestWriteJUnitReport(t *testing.T) {
+	results := []*cfft.TestCaseResult{
+		{Name: "ok", Duration: 1500 * time.Millisecond, ComputeUtilization: 12, Logs: []string{"hello", "world"}},
+		{Name: "diff", ComputeUtilization: 20, Diff: "--- expect\n+++ actual\n", Err: &cfft.DiffError{Diff: "--- expect\n+++ actual\n"}},
+		{Name: "error", Err: errors.New("failed to run test function, TypeError")},
+		{Name: "skip", Skipped: "not ready"},
+	}
+	var buf bytes.Buffer
+	if err := cfft.WriteJUnitReport(&buf, "my-function", results); err != nil {
+		t.Fatal(err)
+	}
+	var report junitReport
+	if err := xml.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.TestSuites) != 1 {
+		t.Fatalf("unexpected testsuites: %s", buf.String())
+	}
+	suite := report.TestSuites[0]
+	if suite.Name != "my-function" || suite.Tests != 4 || suite.Failures != 2 || suite.Skipped != 1 || len(suite.TestCases) != 4 {
+		t.Fatalf("unexpected testsuite: %s", buf.String())
+	}
+	ok := suite.TestCases[0]
+	if ok.Name != "ok" || ok.Time != "1.500" || ok.Failure != nil || ok.SystemOut != "hello\nworld" {
+		t.Errorf("unexpected testcase: %#v", ok)
+	}
+	if len(ok.Properties) != 1 || ok.Properties[0].Name != "ComputeUtilization" || ok.Properties[0].Value != "12" {
+		t.Errorf("unexpected properties: %#v", ok.Properties)
+	}
+	if f := suite.TestCases[1].Failure; f == nil || f.Message != "--- expect\n+++ actual\n" {
+		t.Errorf("unexpected failure: %#v", f)
+	}
+	if f := suite.TestCases[2].Failure; f == nil || f.Message != "failed to run test function, TypeError" {
+		t.Errorf("unexpected failure: %#v", f)
+	}
+	if s := suite.TestCases[3]; s.Failure != nil || s.Skipped == nil || s.Skipped.Message != "not ready" {
+		t.Errorf("unexpected skipped testcase: %#v", s)
+	}
+}
+
+func TestReport(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	conf, err := cfft.LoadConfig(ctx, "examples/add-cache-control/cfft.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := cfft.New(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "report.xml")
+	cli := &cfft.CLI{Test: &cfft.TestCmd{Runner: cfft.RunnerLocal, Report: []string{"junit=" + path}}}
+	if err := app.Dispatch(ctx, []string{"test"}, cli); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report junitReport
+	if err := xml.Unmarshal(b, &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.TestSuites) != 1 || len(report.TestSuites[0].TestCases) != len(conf.TestCases) {
+		t.Errorf("unexpected report: %s", string(b))
+	}
+}
+
+func TestStdoutReportDiff(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	dir := t.TempDir()
+	for _, name := range []string{"cfft.yaml", "function.js", "event.json", "expect.json", "event.yaml", "expect.yaml", "add-cache-control.cfftcase"} {
+		b, err := os.ReadFile(filepath.Join("examples/add-cache-control", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == "function.js" {
+			// the output is changed, so the test cases fail with diffs
+			b = bytes.Replace(b, []byte("max-age=6307200"), []byte("max-age=0"), 1)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conf, err := cfft.LoadConfig(ctx, filepath.Join(dir, "cfft.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := cfft.New(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	app.SetStdout(&stdout)
+	app.SetStderr(&stderr)
+	cli := &cfft.CLI{Test: &cfft.TestCmd{Runner: cfft.RunnerLocal, Report: []string{"json=-"}}}
+	if err := app.Dispatch(ctx, []string{"test"}, cli); err == nil {
+		t.Fatal("expected error")
+	}
+	if !json.Valid(stdout.Bytes()) {
+		t.Errorf("stdout must be the JSON report only: %s", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "max-age=0") {
+		t.Errorf("diffs must be written to stderr: %s", stderr.String())
+	}
+}
+
+func TestInvalidReportOption(t *testing.T) {
+	for _, opt := range []string{"junit", "junit=", "html=report.html"} {
+		cmd := &cfft.TestCmd{Report: []string{opt}}
+		if err := cmd.Setup(); err == nil {
+			t.Errorf("expected error for %s", opt)
+		}
+	}
+}
+
+func TestWriteJSONReport(t *testing.T) {
+	results := []*cfft.TestCaseResult{
+		{Name: "ok", ETag: "E1", Duration: 1500 * time.Millisecond, ComputeUtilization: 12, Logs: []string{"hello"}, Output: []byte(`{"request":{"uri":"/"}}`)},
+		{Name: "diff", ETag: "E1", ComputeUtilization: 20, Diff: "--- expect\n+++ actual\n", Err: &cfft.DiffError{Diff: "--- expect\n+++ actual\n"}},
+	}
+	var buf bytes.Buffer
+	if err := cfft.WriteJSONReport(&buf, "my-function", results); err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Name      string `json:"name"`
+		Passed    int    `json:"passed"`
+		Failed    int    `json:"failed"`
+		TestCases []struct {
+			Name               string          `json:"name"`
+			Status             string          `json:"status"`
+			ETag               string          `json:"etag"`
+			Duration           float64         `json:"duration"`
+			ComputeUtilization int             `json:"computeUtilization"`
+			Logs               []string        `json:"logs"`
+			Output             json.RawMessage `json:"output"`
+			Diff               string          `json:"diff"`
+			Error              string          `json:"error"`
+		} `json:"testCases"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Name != "my-function" || report.Passed != 1 || report.Failed != 1 || len(report.TestCases) != 2 {
+		t.Fatalf("unexpected report: %s", buf.String())
+	}
+	ok := report.TestCases[0]
+	if ok.Status != "passed" || ok.ETag != "E1" || ok.Duration != 1.5 || ok.ComputeUtilization != 12 || len(ok.Logs) != 1 || ok.Error != "" {
+		t.Errorf("unexpected result: %#v", ok)
+	}
+	var output struct {
+		Request struct {
+			URI string `json:"uri"`
+		} `json:"request"`
+	}
+	if err := json.Unmarshal(ok.Output, &output); err != nil || output.Request.URI != "/" {
+		t.Errorf("unexpected output: %s", ok.Output)
+	}
+	ng := report.TestCases[1]
+	if ng.Status != "failed" || ng.Diff == "" || ng.Error != "expect and actual are not equal" || ng.Logs == nil {
+		t.Errorf("unexpected result: %#v", ng)
+	}
+}
+
+var tagsTests = []struct {
+	name        string
+	tags        []string
+	excludeTags []string
+	only        bool
+	expect      map[string]string
+}{
+	{
+		name:   "all",
+		expect: map[string]string{"add-cache-control": "passed", "add-cache-control-text": "passed", "add-cache-control-case": "skipped"},
+	},
+	{
+		name:   "tags",
+		tags:   []string{"smoke"},
+		expect: map[string]string{"add-cache-control": "passed"},
+	},
+	{
+		name:        "exclude tags",
+		excludeTags: []string{"smoke"},
+		expect:      map[string]string{"add-cache-control-text": "passed", "add-cache-control-case": "skipped"},
+	},
+	{
+		name:   "only",
+		only:   true,
+		expect: map[string]string{"add-cache-control": "skipped", "add-cache-control-text": "passed", "add-cache-control-case": "skipped"},
+	},
+}
+
+func TestTags(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	for _, tt := range tagsTests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, err := cfft.LoadConfig(ctx, "examples/add-cache-control/cfft.yaml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			conf.TestCases[0].Tags = []string{"smoke", "fast"}
+			conf.TestCases[1].Tags = []string{"slow"}
+			conf.TestCases[1].Only = tt.only
+			conf.TestCases[2].Skip = "not ready"
+			app, err := cfft.New(ctx, conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), "report.json")
+			cli := &cfft.CLI{Test: &cfft.TestCmd{
+				Runner:      cfft.RunnerLocal,
+				Tags:        tt.tags,
+				ExcludeTags: tt.excludeTags,
+				Report:      []string{"json=" + path},
+			}}
+			if err := app.Dispatch(ctx, []string{"test"}, cli); err != nil {
+				t.Fatal(err)
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var report struct {
+				Skipped   int `json:"skipped"`
+				TestCases []struct {
+					Name       string `json:"name"`
+					Status     string `json:"status"`
+					SkipReason string `json:"skipReason"`
+				} `json:"testCases"`
+			}
+			if err := json.Unmarshal(b, &report); err != nil {
+				t.Fatal(err)
+			}
+			status := map[string]string{}
+			skipped := 0
+			for _, r := range report.TestCases {
+				status[r.Name] = r.Status
+				if r.Status == "skipped" {
+					skipped++
+					if r.SkipReason == "" {
+						t.Errorf("skip reason of %s is empty", r.Name)
+					}
+				}
+			}
+			if diff := cmp.Diff(tt.expect, status); diff != "" {
+				t.Errorf("unexpected statuses (-expect +actual):\n%s", diff)
+			}
+			if report.Skipped != skipped {
+				t.Errorf("unexpected skipped count: %d", report.Skipped)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package cfft
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+)
+
+type RollbackCmd struct {
+	To   string `help:"archive id to roll back to. default is the latest archive saved by publish"`
+	List bool   `help:"list the archives" default:"false"`
+}
+
+func (app *CFFT) RollbackFunction(ctx context.Context, opt *RollbackCmd) error {
+	name := app.config.Name
+	storage := app.archiveStorage()
+	entries, err := storage.List(ctx, name)
+	if err != nil {
+		return err
+	}
+	if opt.List {
+		for _, e := range entries {
+			reason := e.Reason
+			if reason == "" {
+				reason = ArchiveReasonPublish
+			}
+			fmt.Fprintf(app.stdout, "%s\t%s\t%s\t%s\n", e.ID, e.ArchivedAt.Format("2006-01-02T15:04:05Z07:00"), e.ETag, reason)
+		}
+		return nil
+	}
+
+	var entry *ArchiveEntry
+	if opt.To != "" {
+		if err := validateArchiveID(opt.To); err != nil {
+			return err
+		}
+		if entry, err = storage.Load(ctx, name, opt.To); err != nil {
+			return err
+		}
+	} else {
+		if len(entries) == 0 {
+			return fmt.Errorf("no archive of function %s found", name)
+		}
+		entry = entries[len(entries)-1]
+		if entry.IsRollback() {
+			// the latest archive is the code before the last rollback, which is usually the broken one.
+			// which archive to roll back to next is not obvious, so it must be specified.
+			return fmt.Errorf("the latest archive %s of function %s was saved by rollback. specify the archive by --to (see rollback --list)", entry.ID, name)
+		}
+	}
+	slog.Info(f("rolling back function %s to %s", name, entry.ID))
+
+	res, err := app.cloudfront.DescribeFunction(ctx, &cloudfront.DescribeFunctionInput{
+		Name:  aws.String(name),
+		Stage: Stage,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe function, %w", err)
+	}
+	config := entry.Config
+	if config == nil {
+		config = res.FunctionSummary.FunctionConfig
+	}
+	updated, err := app.cloudfront.UpdateFunction(ctx, &cloudfront.UpdateFunctionInput{
+		Name:           aws.String(name),
+		IfMatch:        res.ETag,
+		FunctionCode:   []byte(entry.Code),
+		FunctionConfig: config,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update function, %w", err)
+	}
+	slog.Info(f("function %s is updated by the archive %s", name, entry.ID))
+
+	// the current LIVE function is also archived after the publish, so the rollback can be undone
+	archive, err := app.liveArchiveEntry(ctx, ArchiveReasonRollback)
+	if err != nil {
+		return err
+	}
+	slog.Info(f("publishing function %s...", name))
+	if _, err := app.cloudfront.PublishFunction(ctx, &cloudfront.PublishFunctionInput{
+		Name:    aws.String(name),
+		IfMatch: updated.ETag,
+	}); err != nil {
+		return fmt.Errorf("failed to publish function, %w", err)
+	}
+	slog.Info(f("function %s is rolled back to %s", name, entry.ID))
+	return app.saveArchive(ctx, archive)
+}
@@ -91,3 +91,70 @@ func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 func (h *logHandler) WithGroup(group string) slog.Handler {
 	return h
 }
+
+// recorder records log records and outputs to replay them later in order.
+// It is used to keep the outputs of test cases running in parallel grouped by test case.
+type recorder struct {
+	mu      sync.Mutex
+	entries []recordEntry
+}
+
+type recordEntry struct {
+	handler slog.Handler
+	record  slog.Record
+	output  []byte
+}
+
+// Write records the output.
+func (rec *recorder) Write(b []byte) (int, error) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.entries = append(rec.entries, recordEntry{output: append([]byte(nil), b...)})
+	return len(b), nil
+}
+
+// Handler returns a slog.Handler which records the log records to be handled by h.
+func (rec *recorder) Handler(h slog.Handler) slog.Handler {
+	return &recordHandler{handler: h, rec: rec}
+}
+
+// Replay handles the recorded log records and writes the recorded outputs to w.
+func (rec *recorder) Replay(ctx context.Context, w io.Writer) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	for _, e := range rec.entries {
+		if e.handler != nil {
+			if err := e.handler.Handle(ctx, e.record); err != nil {
+				return err
+			}
+		} else if _, err := w.Write(e.output); err != nil {
+			return err
+		}
+	}
+	rec.entries = nil
+	return nil
+}
+
+type recordHandler struct {
+	handler slog.Handler
+	rec     *recorder
+}
+
+func (h *recordHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h *recordHandler) Handle(ctx context.Context, record slog.Record) error {
+	h.rec.mu.Lock()
+	defer h.rec.mu.Unlock()
+	h.rec.entries = append(h.rec.entries, recordEntry{handler: h.handler, record: record.Clone()})
+	return nil
+}
+
+func (h *recordHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &recordHandler{handler: h.handler.WithAttrs(attrs), rec: h.rec}
+}
+
+func (h *recordHandler) WithGroup(group string) slog.Handler {
+	return &recordHandler{handler: h.handler.WithGroup(group), rec: h.rec}
+}
@@ -3,25 +3,55 @@ package cfft
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"regexp"
+	"strings"
 
 	"github.com/aereal/jsondiff"
 	"github.com/itchyny/gojq"
 )
 
 type TestCase struct {
-	Name   string            `json:"name" yaml:"name"`
-	Event  string            `json:"event" yaml:"event"`
-	Expect string            `json:"expect" yaml:"expect"`
-	Ignore string            `json:"ignore" yaml:"ignore"`
-	Env    map[string]string `json:"env" yaml:"env"`
+	Name                  string            `json:"name" yaml:"name"`
+	Event                 string            `json:"event" yaml:"event"`
+	Expect                string            `json:"expect" yaml:"expect"`
+	Ignore                string            `json:"ignore" yaml:"ignore"`
+	Env                   map[string]string `json:"env" yaml:"env"`
+	MaxComputeUtilization int               `json:"maxComputeUtilization,omitempty" yaml:"maxComputeUtilization,omitempty"`
+	KVS                   *TestCaseKVS      `json:"kvs,omitempty" yaml:"kvs,omitempty"`
+	Assert                []string          `json:"assert,omitempty" yaml:"assert,omitempty"`
+	Match                 string            `json:"match,omitempty" yaml:"match,omitempty"`
+	ExpectError           string            `json:"expectError,omitempty" yaml:"expectError,omitempty"`
+	ExpectLogs            []*LogExpectation `json:"expectLogs,omitempty" yaml:"expectLogs,omitempty"`
+	Matrix                TestCaseMatrix    `json:"matrix,omitempty" yaml:"matrix,omitempty"`
+	Glob                  string            `json:"glob,omitempty" yaml:"glob,omitempty"`
+	BaseEvent             string            `json:"baseEvent,omitempty" yaml:"baseEvent,omitempty"`
+	Patch                 json.RawMessage   `json:"patch,omitempty" yaml:"patch,omitempty"`
+	Tags                  []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Skip                  string            `json:"skip,omitempty" yaml:"skip,omitempty"`
+	Only                  bool              `json:"only,omitempty" yaml:"only,omitempty"`
+	LiveChange            bool              `json:"liveChange,omitempty" yaml:"liveChange,omitempty"`
 
-	id     int
-	event  *CFFEvent
-	expect *CFFExpect
-	ignore *gojq.Query
+	id          int
+	source      string // the test case file discovered by glob
+	event       *CFFEvent
+	expect      *CFFExpect
+	expectMap   map[string]any
+	hasMatchers bool
+	ignore      *gojq.Query
+	assertions  []*assertion
+	errRegexp   *regexp.Regexp
+}
+
+// TestCaseKVS is the KVS fixture of a test case.
+// The keys are put and deleted before the test case runs, and restored after the test case.
+type TestCaseKVS struct {
+	Put    map[string]json.RawMessage `json:"put,omitempty" yaml:"put,omitempty"`
+	Delete []string                   `json:"delete,omitempty" yaml:"delete,omitempty"`
 }
 
 type CFFExpect struct {
@@ -46,6 +76,11 @@ func (c *TestCase) EventBytes() []byte {
 }
 
 func (c *TestCase) ExpectBytes() []byte {
+	if c.hasMatchers {
+		// the matchers are removed from c.expect, so render them as written in the expect file
+		b, _ := json.Marshal(rawMatchers(c.expectMap))
+		return b
+	}
 	b, _ := json.Marshal(c.expect)
 	return b
 }
@@ -57,16 +92,59 @@ func (c *TestCase) Identifier() string {
 	return fmt.Sprintf("[%d]", c.id)
 }
 
+// skipReason returns the reason to skip the test case, or empty if the test case should run.
+// only is true when any of the selected test cases has only.
+func (c *TestCase) skipReason(only bool) string {
+	if c.Skip != "" {
+		return c.Skip
+	}
+	if only && !c.Only {
+		return "other test cases have only"
+	}
+	return ""
+}
+
+// eventPath returns the path of the event file or the base event file.
+func (c *TestCase) eventPath() string {
+	if c.BaseEvent != "" {
+		return c.BaseEvent
+	}
+	return c.Event
+}
+
+// Setup reads the event and expect objects of the test case.
+// readFile should render the templates with the environment variables in c.Env.
 func (c *TestCase) Setup(ctx context.Context, readFile func(string) ([]byte, error)) error {
-	for k, v := range c.Env {
-		df := localEnv(k, v)
-		defer df()
+	if err := validateMatch(c.Match); err != nil {
+		return err
 	}
 
-	eventBytes, err := readFile(c.Event)
+	if c.BaseEvent != "" && c.Event != "" {
+		return fmt.Errorf("event and baseEvent cannot be used together")
+	}
+	if c.BaseEvent == "" && len(c.Patch) > 0 {
+		return fmt.Errorf("patch requires baseEvent")
+	}
+	eventPath := c.eventPath()
+	eventBytes, err := readFile(eventPath)
 	if err != nil {
 		return fmt.Errorf("failed to read event object, %w", err)
 	}
+	var expectBytes []byte
+	if isCaseFile(eventPath) {
+		// the test case file contains both of the event and the expect
+		if len(c.Expect) > 0 {
+			return fmt.Errorf("expect cannot be used with the test case file %s", eventPath)
+		}
+		if eventBytes, expectBytes, err = parseCaseFile(eventBytes); err != nil {
+			return fmt.Errorf("failed to parse test case file %s, %w", eventPath, err)
+		}
+	}
+	if len(c.Patch) > 0 {
+		if eventBytes, err = patchEvent(eventBytes, c.Patch); err != nil {
+			return fmt.Errorf("failed to patch base event %s, %w", eventPath, err)
+		}
+	}
 	var event CFFEvent
 	if err := json.Unmarshal(eventBytes, &event); err != nil {
 		return fmt.Errorf("failed to parse event object as CFF event object, %w", err)
@@ -75,20 +153,43 @@ func (c *TestCase) Setup(ctx context.Context, readFile func(string) ([]byte, err
 
 	if len(c.Expect) > 0 {
 		// expect is optional
-		expectBytes, err := readFile(c.Expect)
+		expectBytes, err = readFile(c.Expect)
 		if err != nil {
 			return fmt.Errorf("failed to read expect object, %w", err)
 		}
 		if len(expectBytes) == 0 {
 			return fmt.Errorf("expect object is empty")
-		} else {
-			slog.Debug(f("expect object: %s", string(expectBytes)))
+		}
+	}
+	if expectBytes != nil {
+		slog.Debug(f("expect object: %s", string(expectBytes)))
+		// matchers are extracted before parsing as CFFExpect, and set to the expect object after that
+		var raw map[string]any
+		if err := json.Unmarshal(expectBytes, &raw); err != nil {
+			return fmt.Errorf("failed to parse expect object, %w", err)
+		}
+		matchers, err := extractMatchers(raw, nil)
+		if err != nil {
+			return fmt.Errorf("failed to parse expect object, %w", err)
+		}
+		if len(matchers) > 0 {
+			if expectBytes, err = json.Marshal(raw); err != nil {
+				return fmt.Errorf("failed to parse expect object, %w", err)
+			}
 		}
 		var expect CFFExpect
 		if err := json.Unmarshal(expectBytes, &expect); err != nil {
 			return fmt.Errorf("failed to parse expect object, %w", err)
 		}
 		c.expect = &expect
+		c.expectMap = expect.ToMap()
+		if c.Match == MatchSubset {
+			c.expectMap = subsetExpect(raw, c.expectMap)
+		}
+		for _, m := range matchers {
+			setPath(c.expectMap, m.path, m.matcher)
+		}
+		c.hasMatchers = len(matchers) > 0
 	}
 
 	if len(c.Ignore) > 0 {
@@ -99,10 +200,75 @@ func (c *TestCase) Setup(ctx context.Context, readFile func(string) ([]byte, err
 		}
 		c.ignore = q
 	}
+
+	if e := c.ExpectError; len(e) >= 2 && strings.HasPrefix(e, "/") && strings.HasSuffix(e, "/") {
+		re, err := regexp.Compile(e[1 : len(e)-1])
+		if err != nil {
+			return fmt.Errorf("failed to compile expectError %s, %w", e, err)
+		}
+		c.errRegexp = re
+	}
+
+	for _, e := range c.ExpectLogs {
+		if err := e.setup(); err != nil {
+			return err
+		}
+	}
+
+	assertions, err := compileAssertions(c.Assert)
+	if err != nil {
+		return err
+	}
+	c.assertions = assertions
+	return nil
+}
+
+// Run checks the result of the function. The diff between the expected and actual output is written to w.
+func (c *TestCase) Run(ctx context.Context, res *FunctionResult, logger *slog.Logger, w io.Writer) error {
+	var errs []error
+	if err := c.checkOutput(ctx, res.Output, logger, w); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, c.checkAssertions(res.Output, logger)...)
+	if err := c.checkLogs(res.Logs, logger); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if max := c.MaxComputeUtilization; max > 0 && res.ComputeUtilization > max {
+		return fmt.Errorf("ComputeUtilization %d exceeds maxComputeUtilization %d", res.ComputeUtilization, max)
+	}
 	return nil
 }
 
-func (c *TestCase) Run(ctx context.Context, output []byte, logger *slog.Logger) error {
+// checkFunctionError checks that the function failed with the expected error.
+func (c *TestCase) checkFunctionError(res *FunctionResult, err error, logger *slog.Logger) (*FunctionResult, error) {
+	if err == nil {
+		return res, fmt.Errorf("function succeeded, but an error matching %s is expected", c.ExpectError)
+	}
+	var ferr *FunctionError
+	if !errors.As(err, &ferr) {
+		return nil, fmt.Errorf("failed to run test function, %w", err)
+	}
+	res = &FunctionResult{
+		ComputeUtilization: ferr.ComputeUtilization,
+		Logs:               ferr.Logs,
+	}
+	var matched bool
+	if c.errRegexp != nil {
+		matched = c.errRegexp.MatchString(ferr.Message)
+	} else {
+		matched = strings.Contains(ferr.Message, c.ExpectError)
+	}
+	if !matched {
+		return res, fmt.Errorf("function error %q does not match %s", ferr.Message, c.ExpectError)
+	}
+	logger.Info(f("function error %q matches the expected error", ferr.Message))
+	return res, c.checkLogs(res.Logs, logger)
+}
+
+func (c *TestCase) checkOutput(ctx context.Context, output []byte, logger *slog.Logger, w io.Writer) error {
 	logger.Debug(f("function output: %s", string(output)))
 	if c.expect == nil {
 		logger.Info("no expected value. skipping checking function output")
@@ -118,23 +284,41 @@ func (c *TestCase) Run(ctx context.Context, output []byte, logger *slog.Logger)
 	if c.ignore != nil {
 		options = append(options, jsondiff.Ignore(c.ignore))
 	}
+	var actual any = result.ToMap()
+	if c.Match == MatchSubset {
+		// compare only the keys in the expect file
+		actual = projectSubset(c.expectMap, actual)
+	}
+	var expect any = c.expectMap
+	if c.hasMatchers {
+		expect = applyMatchers(c.expectMap, actual)
+	}
 	diff, err := jsondiff.Diff(
-		&jsondiff.Input{Name: "expect", X: c.expect.ToMap()},
-		&jsondiff.Input{Name: "actual", X: result.ToMap()},
+		&jsondiff.Input{Name: "expect", X: expect},
+		&jsondiff.Input{Name: "actual", X: actual},
 		options...,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to diff, %w", err)
 	}
 	if diff != "" {
-		fmt.Print(coloredDiff(diff))
-		return fmt.Errorf("expect and actual are not equal")
+		fmt.Fprint(w, coloredDiff(diff))
+		return &DiffError{Diff: diff}
 	} else {
 		logger.Info("expect and actual are equal")
 	}
 	return nil
 }
 
+// DiffError is returned when the function output is not equal to the expected value.
+type DiffError struct {
+	Diff string
+}
+
+func (e *DiffError) Error() string {
+	return "expect and actual are not equal"
+}
+
 func localEnv(key, value string) func() {
 	prevValue, ok := os.LookupEnv(key)
 
@@ -1,6 +1,11 @@
 package cfft_test
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
 	"testing"
 
 	"github.com/fujiwara/cfft"
@@ -45,3 +50,248 @@ func TestSetupText(t *testing.T) {
 		})
 	}
 }
+
+func TestMaxComputeUtilization(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	testCase := &cfft.TestCase{
+		Event:                 "testdata/event.json",
+		MaxComputeUtilization: 30,
+	}
+	if err := testCase.Setup(ctx, cfft.ReadFile); err != nil {
+		t.Fatal(err)
+	}
+	output := []byte(`{"request":{"method":"GET","uri":"/"}}`)
+	if err := testCase.Run(ctx, &cfft.FunctionResult{Output: output, ComputeUtilization: 30}, slog.Default(), io.Discard); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err := testCase.Run(ctx, &cfft.FunctionResult{Output: output, ComputeUtilization: 31}, slog.Default(), io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "ComputeUtilization 31 exceeds maxComputeUtilization 30") {
+		t.Errorf("expected error, got %v", err)
+	}
+}
+
+var assertTests = []struct {
+	name   string
+	assert []string
+	errs   []string
+}{
+	{
+		name:   "pass",
+		assert: []string{`.response.statusCode == 302`, `.response.headers.location.value | test("^https://")`},
+	},
+	{
+		name:   "false",
+		assert: []string{`.response.statusCode == 200`, `.response.headers.location.value | startswith("/")`},
+		errs:   []string{"assertion .response.statusCode == 200 is false", `assertion .response.headers.location.value | startswith("/") is false`},
+	},
+	{
+		name:   "non-boolean",
+		assert: []string{`.response.statusCode`},
+		errs:   []string{"returned a non-boolean value: 302"},
+	},
+	{
+		name:   "runtime error",
+		assert: []string{`.response.statusCode | test("3")`},
+		errs:   []string{"failed with error"},
+	},
+	{
+		name:   "no value",
+		assert: []string{`empty`},
+		errs:   []string{"returned no value"},
+	},
+}
+
+func TestAssert(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	output := []byte(`{"response":{"statusCode":302,"headers":{"location":{"value":"https://example.com/"}}}}`)
+	for _, tt := range assertTests {
+		t.Run(tt.name, func(t *testing.T) {
+			testCase := &cfft.TestCase{
+				Event:  "testdata/event.json",
+				Assert: tt.assert,
+			}
+			if err := testCase.Setup(ctx, cfft.ReadFile); err != nil {
+				t.Fatal(err)
+			}
+			err := testCase.Run(ctx, &cfft.FunctionResult{Output: output}, slog.Default(), io.Discard)
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			for _, e := range tt.errs {
+				if !strings.Contains(err.Error(), e) {
+					t.Errorf("error %q must contain %q", err, e)
+				}
+			}
+		})
+	}
+}
+
+func TestAssertInvalid(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	testCase := &cfft.TestCase{
+		Event:  "testdata/event.json",
+		Assert: []string{`.response.statusCode ==`},
+	}
+	if err := testCase.Setup(ctx, cfft.ReadFile); err == nil {
+		t.Error("expected error for invalid assertion")
+	}
+}
+
+var matchSubsetTests = []struct {
+	name   string
+	match  string
+	expect string
+	diff   []string
+}{
+	{
+		name:   "subset",
+		match:  "subset",
+		expect: `{"response":{"statusCode":200,"headers":{"cache-control":{"value":"public"}}}}`,
+	},
+	{
+		name:   "subset text format",
+		match:  "subset",
+		expect: `{"response":"HTTP/1.1 200 OK\nCache-Control: public\n"}`,
+	},
+	{
+		name:   "subset missing",
+		match:  "subset",
+		expect: `{"response":{"headers":{"cache-control":{"value":"public"},"x-foo":{"value":"bar"}}}}`,
+		diff:   []string{`-      "x-foo"`},
+	},
+	{
+		name:   "subset different",
+		match:  "subset",
+		expect: `{"response":{"statusCode":302}}`,
+		diff:   []string{`-    "statusCode": 302`, `+    "statusCode": 200`},
+	},
+	{
+		name:   "exact",
+		expect: `{"response":{"statusCode":200,"headers":{"cache-control":{"value":"public"}}}}`,
+		diff:   []string{`+      "x-bar"`},
+	},
+}
+
+func TestMatchSubset(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	output := []byte(`{"response":{"statusCode":200,"statusDescription":"OK","headers":{"cache-control":{"value":"public"},"x-bar":{"value":"baz"}},"cookies":{}}}`)
+	for _, tt := range matchSubsetTests {
+		t.Run(tt.name, func(t *testing.T) {
+			testCase := &cfft.TestCase{
+				Event:  "testdata/event.json",
+				Expect: "expect.json",
+				Match:  tt.match,
+			}
+			readFile := func(p string) ([]byte, error) {
+				if p == "expect.json" {
+					return []byte(tt.expect), nil
+				}
+				return cfft.ReadFile(p)
+			}
+			if err := testCase.Setup(ctx, readFile); err != nil {
+				t.Fatal(err)
+			}
+			var buf strings.Builder
+			err := testCase.Run(ctx, &cfft.FunctionResult{Output: output}, slog.Default(), &buf)
+			if len(tt.diff) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v %s", err, buf.String())
+				}
+				return
+			}
+			var derr *cfft.DiffError
+			if !errors.As(err, &derr) {
+				t.Fatalf("expected diff error, got %v", err)
+			}
+			for _, d := range tt.diff {
+				if !strings.Contains(derr.Diff, d) {
+					t.Errorf("diff must contain %q\n%s", d, derr.Diff)
+				}
+			}
+		})
+	}
+}
+
+func TestMatchInvalid(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	testCase := &cfft.TestCase{Event: "testdata/event.json", Match: "partial"}
+	if err := testCase.Setup(ctx, cfft.ReadFile); err == nil {
+		t.Error("expected error for invalid match")
+	}
+}
+
+var expectLogsTests = []struct {
+	name string
+	logs []string
+	err  string
+}{
+	{
+		name: "matched",
+		logs: []string{"start", "hello", "b1", "xx cc yy"},
+	},
+	{
+		name: "out of order",
+		logs: []string{"b1", "hello", "xx cc yy"},
+		err:  `expected log line regex ^b\d$ is not found`,
+	},
+	{
+		name: "missing",
+		logs: []string{"hello", "b1"},
+		err:  `expected log line contains "cc" is not found`,
+	},
+	{
+		name: "exact",
+		logs: []string{"hello world", "b1", "cc"},
+		err:  `expected log line "hello" is not found`,
+	},
+}
+
+func TestExpectLogs(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	output := []byte(`{"request":{"method":"GET","uri":"/"}}`)
+	for _, tt := range expectLogsTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var testCase cfft.TestCase
+			src := `{"event":"testdata/event.json","expectLogs":["hello",{"regex":"^b\\d$"},{"contains":"cc"}]}`
+			if err := json.Unmarshal([]byte(src), &testCase); err != nil {
+				t.Fatal(err)
+			}
+			if err := testCase.Setup(ctx, cfft.ReadFile); err != nil {
+				t.Fatal(err)
+			}
+			err := testCase.Run(ctx, &cfft.FunctionResult{Output: output, Logs: tt.logs}, slog.Default(), io.Discard)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestExpectLogsInvalid(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	for _, src := range []string{
+		`{"event":"testdata/event.json","expectLogs":[{"regex":"a","contains":"b"}]}`,
+		`{"event":"testdata/event.json","expectLogs":[{}]}`,
+		`{"event":"testdata/event.json","expectLogs":[{"regex":"("}]}`,
+	} {
+		var testCase cfft.TestCase
+		if err := json.Unmarshal([]byte(src), &testCase); err != nil {
+			t.Fatal(err)
+		}
+		if err := testCase.Setup(ctx, cfft.ReadFile); err == nil {
+			t.Errorf("expected error for %s", src)
+		}
+	}
+}
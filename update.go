@@ -0,0 +1,209 @@
+package cfft
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+
+	"github.com/goccy/go-yaml"
+	"github.com/itchyny/gojq"
+)
+
+// updateExpects writes the actual outputs of the test cases to their expect files.
+// The test cases which failed only by the diff are regarded as passed after updated.
+func (app *CFFT) updateExpects(cases []*TestCase, results []*TestCaseResult) error {
+	var errs []error
+	for i, r := range results {
+		if r.Output == nil {
+			// the function failed. nothing to update
+			continue
+		}
+		if r.Err != nil && !isDiffErrorOnly(r.Err) {
+			// other errors are not fixed by updating the expect file
+			continue
+		}
+		if err := app.updateExpect(cases[i], r.Output); err != nil {
+			errs = append(errs, fmt.Errorf("failed to update expect of test case %s, %w", r.Name, err))
+			continue
+		}
+		r.Err = nil
+	}
+	return errors.Join(errs...)
+}
+
+func (app *CFFT) updateExpect(cs *TestCase, output []byte) error {
+	var actual CFFExpect
+	if err := json.Unmarshal(output, &actual); err != nil {
+		return fmt.Errorf("failed to parse function output, %w", err)
+	}
+	newExpect := actual.ToMap()
+
+	if isCaseFile(cs.eventPath()) {
+		return fmt.Errorf("updating the test case file %s is not supported", cs.eventPath())
+	}
+
+	created := false
+	if cs.Expect == "" {
+		cs.Expect = app.newExpectPath(cs)
+		created = true
+	} else if cs.expect != nil {
+		if cs.Match == MatchSubset {
+			// keep only the keys in the expect file
+			newExpect, _ = projectSubset(cs.expectMap, newExpect).(map[string]any)
+		}
+		oldExpect := cs.expectMap
+		if cs.hasMatchers {
+			// keep the matchers which match the actual values
+			newExpect, _ = keepMatchers(cs.expectMap, newExpect).(map[string]any)
+			oldExpect, _ = rawMatchers(cs.expectMap).(map[string]any)
+		}
+		if cs.Ignore != "" {
+			v, err := preserveIgnored(cs.Ignore, oldExpect, newExpect)
+			if err != nil {
+				return err
+			}
+			newExpect = v
+		}
+		if reflect.DeepEqual(oldExpect, newExpect) {
+			slog.Debug(f("expect file %s is not changed", cs.Expect))
+			return nil
+		}
+	}
+
+	path := filepath.Join(app.config.dir, cs.Expect)
+	if !created {
+		if err := app.checkExpectUpdatable(cs, path); err != nil {
+			return err
+		}
+	}
+	b, err := marshalExpect(path, newExpect)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return fmt.Errorf("failed to write expect file %s, %w", path, err)
+	}
+	if created {
+		slog.Info(f("expect file %s created. add `expect: %s` to the test case %s in the config", path, cs.Expect, cs.Identifier()))
+	} else {
+		slog.Info(f("expect file %s updated", path))
+	}
+	return nil
+}
+
+// checkExpectUpdatable returns an error if the expect file cannot be rewritten by the actual output
+// without losing its content. The output of the function is a plain JSON, so Jsonnet expressions and
+// template actions are lost, and the values for one env are baked into the file shared by the test cases.
+func (app *CFFT) checkExpectUpdatable(cs *TestCase, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read expect file %s, %w", path, err)
+	}
+	if bytes.Contains(b, []byte("{{")) {
+		return fmt.Errorf("expect file %s contains template actions, which cannot be updated. update it by hand", path)
+	}
+	switch filepath.Ext(path) {
+	case ".json", ".jsonnet":
+		// both are evaluated as Jsonnet. a plain JSON is also valid Jsonnet, so it can be updated
+		if !json.Valid(b) {
+			return fmt.Errorf("expect file %s contains Jsonnet expressions, which cannot be updated. update it by hand", path)
+		}
+	}
+	for _, c := range app.config.TestCases {
+		if c != cs && c.Expect != "" && filepath.Clean(c.Expect) == filepath.Clean(cs.Expect) && !maps.Equal(c.Env, cs.Env) {
+			return fmt.Errorf("expect file %s is shared by the test cases %s and %s with different env, which cannot be updated. update it by hand", path, cs.Identifier(), c.Identifier())
+		}
+	}
+	return nil
+}
+
+var unsafeFileNameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// newExpectPath returns the path of the expect file to create for the test case.
+// The file is expect.<ext> in the directory of the event file.
+// If the path is already used by another test case, the test case identifier is added to the file name.
+func (app *CFFT) newExpectPath(cs *TestCase) string {
+	ext := filepath.Ext(cs.eventPath())
+	switch ext {
+	case ".json", ".jsonnet", ".yaml", ".yml":
+	default:
+		ext = ".json"
+	}
+	dir := filepath.Dir(cs.eventPath())
+	p := filepath.Join(dir, "expect"+ext)
+	for _, c := range app.config.TestCases {
+		if c != cs && c.Expect != "" && filepath.Clean(c.Expect) == p {
+			name := unsafeFileNameChars.ReplaceAllString(cs.Identifier(), "_")
+			return filepath.Join(dir, "expect-"+name+ext)
+		}
+	}
+	return p
+}
+
+// preserveIgnored copies the values pointed by the ignore query from the old expect to the new one.
+func preserveIgnored(ignore string, oldExpect, newExpect map[string]any) (map[string]any, error) {
+	q, err := gojq.Parse(f(
+		`. as $old | $new | reduce ($old | path(%s)) as $p (.; ($old | getpath($p)) as $v | if $v == null then . else setpath($p; $v) end)`,
+		ignore,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ignore query, %w", err)
+	}
+	code, err := gojq.Compile(q, gojq.WithVariables([]string{"$new"}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile ignore query, %w", err)
+	}
+	iter := code.Run(oldExpect, newExpect)
+	v, ok := iter.Next()
+	if !ok {
+		return newExpect, nil
+	}
+	if err, ok := v.(error); ok {
+		return nil, fmt.Errorf("failed to preserve ignored values, %w", err)
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unexpected result of ignore query: %v", v)
+	}
+	return m, nil
+}
+
+// marshalExpect marshals the expect object in the format of the file extension.
+func marshalExpect(path string, v map[string]any) ([]byte, error) {
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal expect as yaml, %w", err)
+		}
+		return b, nil
+	default:
+		// JSON is also valid Jsonnet
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal expect as json, %w", err)
+		}
+		return append(b, '\n'), nil
+	}
+}
+
+// isDiffErrorOnly reports whether err consists of only DiffError.
+func isDiffErrorOnly(err error) bool {
+	if errs, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range errs.Unwrap() {
+			if !isDiffErrorOnly(e) {
+				return false
+			}
+		}
+		return true
+	}
+	_, ok := err.(*DiffError)
+	return ok
+}
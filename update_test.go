@@ -0,0 +1,213 @@
+package cfft_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fujiwara/cfft"
+)
+
+const updateTestConfig = `
+name: update-test
+function: function.js
+runner: local
+testCases:
+  - name: stale
+    event: event.json
+    expect: stale.json
+    ignore: '.response.headers["x-date"]'
+  - name: yaml
+    event: event.json
+    expect: stale.yaml
+  - name: jsonnet
+    event: event.json
+    expect: stale.jsonnet
+  - name: unchanged
+    event: event.json
+    expect: unchanged.json
+  - name: new
+    event: event.json
+`
+
+func TestUpdate(t *testing.T) {
+	ctx := cfft.NewTestContext()
+	dir := t.TempDir()
+	for _, name := range []string{"function.js", "event.json"} {
+		b, err := os.ReadFile(filepath.Join("examples/add-cache-control", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	unchanged, err := os.ReadFile("examples/add-cache-control/expect.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"cfft.yaml":      updateTestConfig,
+		"stale.json":     `{"response":{"statusCode":{"$range":[200,299]},"headers":{"x-date":{"value":"old"},"cache-control":{"value":"no-cache"}}}}`,
+		"stale.yaml":     "response:\n  statusCode: 404\n",
+		"stale.jsonnet":  `{"response":{"statusCode":404}}`,
+		"unchanged.json": string(unchanged),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conf, err := cfft.LoadConfig(ctx, filepath.Join(dir, "cfft.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := cfft.New(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli := &cfft.CLI{Test: &cfft.TestCmd{Update: true}}
+	if err := app.Dispatch(ctx, []string{"test"}, cli); err != nil {
+		t.Fatalf("update must succeed: %v", err)
+	}
+
+	var stale map[string]any
+	b, _ := os.ReadFile(filepath.Join(dir, "stale.json"))
+	if err := json.Unmarshal(b, &stale); err != nil {
+		t.Fatal(err)
+	}
+	headers := stale["response"].(map[string]any)["headers"].(map[string]any)
+	if v := headers["cache-control"].(map[string]any)["value"]; v != "public, max-age=6307200" {
+		t.Errorf("cache-control is not updated: %v", v)
+	}
+	if v := headers["x-date"].(map[string]any)["value"]; v != "old" {
+		t.Errorf("ignored value is not preserved: %v", v)
+	}
+	if v, ok := stale["response"].(map[string]any)["statusCode"].(map[string]any); !ok || v["$range"] == nil {
+		t.Errorf("matched matcher is not preserved: %v", stale["response"])
+	}
+
+	b, _ = os.ReadFile(filepath.Join(dir, "stale.yaml"))
+	if !strings.Contains(string(b), "statusCode: 200") || !strings.Contains(string(b), "public, max-age=6307200") {
+		t.Errorf("yaml is not updated: %s", b)
+	}
+
+	// plain JSON in a .jsonnet file is updated as JSON
+	b, _ = os.ReadFile(filepath.Join(dir, "stale.jsonnet"))
+	if !json.Valid(b) || !strings.Contains(string(b), "public, max-age=6307200") {
+		t.Errorf("jsonnet is not updated: %s", b)
+	}
+
+	b, _ = os.ReadFile(filepath.Join(dir, "unchanged.json"))
+	if string(b) != string(unchanged) {
+		t.Errorf("unchanged expect file must not be rewritten: %s", b)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "expect.json")); err != nil {
+		t.Errorf("expect file for the new test case must be created: %v", err)
+	}
+
+	// all test cases pass after updated
+	conf, err = cfft.LoadConfig(ctx, filepath.Join(dir, "cfft.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err = cfft.New(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Dispatch(ctx, []string{"test"}, &cfft.CLI{Test: &cfft.TestCmd{}}); err != nil {
+		t.Errorf("test must pass after updated: %v", err)
+	}
+}
+
+func TestUpdateRefused(t *testing.T) {
+	concrete := strings.NewReplacer("{{ env `IP` `127.0.0.2` }}", "127.0.0.2", "{{ env `HOSTNAME` `unknown` }}", "unknown")
+	for _, tt := range []struct {
+		name   string
+		expect string
+		setup  func(config, expect string) (string, string)
+		err    string
+	}{
+		{
+			name:   "template",
+			expect: "expect.json",
+			setup:  func(config, expect string) (string, string) { return config, expect },
+			err:    "template actions",
+		},
+		{
+			name:   "shared with different env",
+			expect: "expect.json",
+			setup: func(config, expect string) (string, string) {
+				return config, concrete.Replace(expect)
+			},
+			err: "different env",
+		},
+		{
+			name:   "jsonnet",
+			expect: "expect.jsonnet",
+			setup: func(config, expect string) (string, string) {
+				return strings.ReplaceAll(config, "expect.json", "expect.jsonnet"), "// hostname lookup\n" + concrete.Replace(expect)
+			},
+			err: "Jsonnet",
+		},
+		{
+			name:   "jsonnet in json",
+			expect: "expect.json",
+			setup: func(config, expect string) (string, string) {
+				return config, "// hostname lookup\n" + concrete.Replace(expect)
+			},
+			err: "Jsonnet",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := cfft.NewTestContext()
+			dir := t.TempDir()
+			src := "testdata/true-client-ip"
+			read := func(name string) string {
+				b, err := os.ReadFile(filepath.Join(src, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return string(b)
+			}
+			config, expect := tt.setup(read("cfft.yaml"), read("expect.json"))
+			files := map[string]string{
+				"cfft.yaml":        config,
+				tt.expect:          expect,
+				"event.json":       read("event.json"),
+				"kvs-fixture.yaml": read("kvs-fixture.yaml"),
+				// the output is changed, so the expect file must be updated
+				"function.js": strings.Replace(read("function.js"), "return request;", "request.headers['x-new'] = { value: 'new' };\n  return request;", 1),
+			}
+			for name, content := range files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			conf, err := cfft.LoadConfig(ctx, filepath.Join(dir, "cfft.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			app, err := cfft.New(ctx, conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cli := &cfft.CLI{Test: &cfft.TestCmd{Runner: cfft.RunnerLocal, Update: true}}
+			err = app.Dispatch(ctx, []string{"test"}, cli)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error containing %q, got %v", tt.err, err)
+			}
+			b, err := os.ReadFile(filepath.Join(dir, tt.expect))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != expect {
+				t.Errorf("expect file must not be rewritten: %s", b)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package cfft
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// watchInterval is the interval to check the modification of the watched files.
+	watchInterval = 500 * time.Millisecond
+	// watchDebounce is the duration to wait for the files to settle after the last change.
+	watchDebounce = 300 * time.Millisecond
+)
+
+// watchTest runs the test cases and reruns them when the watched files are changed, until ctx is canceled.
+func (app *CFFT) watchTest(ctx context.Context, opt *TestCmd) error {
+	if err := app.testFunction(ctx, opt, app.config.TestCases); err != nil {
+		slog.Error(err.Error())
+	}
+	w := newFileWatcher(app.watchFiles)
+	for {
+		slog.Info("watching files for changes. press Ctrl+C to stop")
+		changed, err := w.wait(ctx)
+		if err != nil {
+			// canceled
+			return nil
+		}
+		slog.Info(f("changed: %s", strings.Join(changed, ", ")))
+
+		config, err := LoadConfig(ctx, app.config.path)
+		if err != nil {
+			slog.Error(f("failed to reload config, %s", err))
+			continue
+		}
+		cases := affectedTestCases(config, changed)
+		app.config = config
+		w.reset()
+		if app.runnerName(opt) == RunnerLocal && config.KVS != nil && config.KVS.Local != "" {
+			if err := app.prepareLocalKVS(ctx); err != nil {
+				slog.Error(err.Error())
+				continue
+			}
+		}
+		if err := app.testFunction(ctx, opt, cases); err != nil {
+			slog.Error(err.Error())
+		}
+	}
+}
+
+// watchFiles returns the files to watch. The paths are relative to the current directory.
+func (app *CFFT) watchFiles() []string {
+	c := app.config
+	files := []string{c.path}
+	for _, fn := range c.function.Functions {
+		files = append(files, filepath.Join(c.dir, fn))
+	}
+	if c.KVS != nil && c.KVS.Local != "" {
+		files = append(files, filepath.Join(c.dir, c.KVS.Local))
+	}
+	for _, tc := range c.TestCases {
+		files = append(files, tc.files(c.dir)...)
+	}
+	for _, g := range c.globs {
+		// new test case files are also watched
+		found, err := globFiles(c.dir, g)
+		if err != nil {
+			slog.Warn(err.Error())
+			continue
+		}
+		for _, file := range found {
+			files = append(files, filepath.Join(c.dir, file))
+		}
+	}
+	sort.Strings(files)
+	return slices.Compact(files)
+}
+
+// files returns the files of the test case joined with dir.
+func (c *TestCase) files(dir string) []string {
+	var files []string
+	for _, p := range []string{c.source, c.Event, c.BaseEvent, c.Expect} {
+		if p != "" {
+			files = append(files, filepath.Join(dir, p))
+		}
+	}
+	return files
+}
+
+// affectedTestCases returns the test cases affected by the changed files.
+// If a changed file is not a file of the test cases (e.g. the function or the config), all the test cases are affected.
+func affectedTestCases(config *Config, changed []string) []*TestCase {
+	owners := map[string][]*TestCase{}
+	for _, tc := range config.TestCases {
+		for _, file := range tc.files(config.dir) {
+			owners[file] = append(owners[file], tc)
+		}
+	}
+	affected := map[*TestCase]bool{}
+	for _, file := range changed {
+		tcs, ok := owners[file]
+		if !ok {
+			return config.TestCases
+		}
+		for _, tc := range tcs {
+			affected[tc] = true
+		}
+	}
+	var cases []*TestCase
+	for _, tc := range config.TestCases {
+		if affected[tc] {
+			cases = append(cases, tc)
+		}
+	}
+	return cases
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// fileWatcher detects the changes of the files by polling the modification time and size.
+type fileWatcher struct {
+	files func() []string
+	state map[string]fileState
+}
+
+func newFileWatcher(files func() []string) *fileWatcher {
+	w := &fileWatcher{files: files}
+	w.reset()
+	return w
+}
+
+// reset takes a new snapshot of the files.
+func (w *fileWatcher) reset() {
+	w.state = w.snapshot()
+}
+
+func (w *fileWatcher) snapshot() map[string]fileState {
+	state := map[string]fileState{}
+	for _, file := range w.files() {
+		st, err := os.Stat(file)
+		if err != nil {
+			// a removed file is regarded as a zero state
+			state[file] = fileState{}
+			continue
+		}
+		state[file] = fileState{modTime: st.ModTime(), size: st.Size()}
+	}
+	return state
+}
+
+// wait waits for the files to be changed and returns the changed files.
+// It returns after no more changes are detected for watchDebounce, to run once for successive saves.
+func (w *fileWatcher) wait(ctx context.Context) ([]string, error) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	changed := map[string]bool{}
+	var last time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+		current := w.snapshot()
+		for file, st := range current {
+			if prev, ok := w.state[file]; !ok || prev != st {
+				changed[file] = true
+				last = time.Now()
+			}
+		}
+		for file := range w.state {
+			if _, ok := current[file]; !ok {
+				changed[file] = true
+				last = time.Now()
+			}
+		}
+		w.state = current
+		if len(changed) > 0 && time.Since(last) >= watchDebounce {
+			files := make([]string, 0, len(changed))
+			for file := range changed {
+				files = append(files, file)
+			}
+			sort.Strings(files)
+			return files, nil
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package cfft_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fujiwara/cfft"
+)
+
+func TestWatch(t *testing.T) {
+	cfft.SetWatchInterval(10*time.Millisecond, 30*time.Millisecond)
+	defer cfft.SetWatchInterval(500*time.Millisecond, 300*time.Millisecond)
+
+	dir := t.TempDir()
+	for _, name := range []string{"cfft.yaml", "function.js", "event.json", "expect.json", "event.yaml", "expect.yaml", "add-cache-control.cfftcase"} {
+		b, err := os.ReadFile(filepath.Join("examples/add-cache-control", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(cfft.NewTestContext())
+	defer cancel()
+	conf, err := cfft.LoadConfig(ctx, filepath.Join(dir, "cfft.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := cfft.New(ctx, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := filepath.Join(dir, "report.json")
+	cli := &cfft.CLI{Test: &cfft.TestCmd{Runner: cfft.RunnerLocal, Watch: true, Report: []string{"json=" + report}}}
+	done := make(chan error)
+	go func() {
+		done <- app.Dispatch(ctx, []string{"test"}, cli)
+	}()
+
+	// readReport waits for the report which has n test cases
+	readReport := func(n int) map[string]string {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case <-timeout:
+				t.Fatalf("report of %d test cases is not written", n)
+			case <-time.After(10 * time.Millisecond):
+			}
+			b, err := os.ReadFile(report)
+			if err != nil {
+				continue
+			}
+			var r struct {
+				TestCases []struct {
+					Name   string `json:"name"`
+					Status string `json:"status"`
+				} `json:"testCases"`
+			}
+			if json.Unmarshal(b, &r) != nil || len(r.TestCases) != n {
+				continue
+			}
+			os.Remove(report)
+			status := map[string]string{}
+			for _, tc := range r.TestCases {
+				status[tc.Name] = tc.Status
+			}
+			return status
+		}
+	}
+	touch := func(name, content string) {
+		t.Helper()
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		future := time.Now().Add(time.Minute)
+		if err := os.Chtimes(p, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if s := readReport(3); s["add-cache-control"] != "passed" {
+		t.Errorf("unexpected first run: %v", s)
+	}
+
+	// changing an expect file reruns only the test case
+	touch("expect.json", `{"response":{"statusCode":404}}`)
+	if s := readReport(1); s["add-cache-control"] != "failed" {
+		t.Errorf("unexpected rerun by expect file: %v", s)
+	}
+
+	// changing the function reruns all the test cases
+	touch("function.js", `async function handler(event) { return event.response; }`)
+	s := readReport(3)
+	for name, status := range s {
+		if status != "failed" {
+			t.Errorf("test case %s must fail after the function changed: %s", name, status)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("watch must return nil after canceled: %v", err)
+	}
+}